@@ -4,6 +4,10 @@ set GOPATH=%~dp0
 go get -u github.com/disintegration/gift
 go get -u github.com/olebedev/config
 go get -u github.com/mitchellh/mapstructure
+go get -u github.com/fsnotify/fsnotify
+go get -u golang.org/x/image/tiff
+go get -u golang.org/x/image/bmp
+go get -u golang.org/x/image/webp
 pushd %~dp0src\lec3-ip
 go install
 popd
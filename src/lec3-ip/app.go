@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"time"
 	"os"
-	"image"
+	"os/signal"
+	"syscall"
+	"sync/atomic"
 	"path"
+	"path/filepath"
+	"strings"
 	"runtime"
 	"sync"
-	"reflect"
 	"log"
+	"lec3-ip/ip"
+)
+
+// exit status
+const (
+	exitSuccess     = 0
+	exitError       = 1   // failed to start
+	exitFailed      = 2   // failed to process one or more images
+	exitInterrupted = 130 // stopped by signal. watch mode exits with 0 or 2 if images in progress are finished
 )
 
 //-----------------------------------------------------------------------------
@@ -18,109 +32,464 @@ import (
 
 type Work struct {
 	dir      string
-	filename string
-	quit     bool
+	filename string       // slash separated path relative to dir
+	page     ip.ImagePage // page of multi-page file or archive
+	dests    []workDest   // dest of page in each output
+	src      *srcFile     // shared by pages of the file
+}
+
+// Dest of work in output
+type workDest struct {
+	book  string // group of ordered sink. book filename in package mode, or dest folder of sequence numbering
+	index int    // page index in book, or in numbering group of output name
+}
+
+// Key of work in process state
+func (w Work) key() string {
+	if w.page.Entry != "" {
+		return w.filename + "#" + w.page.Entry
+	}
+	if w.page.IsMultiPage() {
+		return fmt.Sprintf("%v#%v", w.filename, w.page.Index + 1)
+	}
+	return w.filename
+}
+
+// Slash separated output folder relative to dest directory. ex) vol1, vol2/book/ch1
+func (w Work) folder() string {
+	return path.Join(path.Dir(w.filename), w.page.Dir())
+}
+
+// Number of pages added to each numbering group
+type pageCounter struct {
+	counts     map[string]int    // key : numbering group
+	books      map[string]bool   // groups written by ordered sink
+	bookGroups map[string]string // source group of each book filename in package mode
+}
+
+func newPageCounter() *pageCounter {
+	return &pageCounter{counts: make(map[string]int), books: make(map[string]bool), bookGroups: make(map[string]string)}
+}
+
+// Page counters of outputs
+func newPageCounters(outputs []*output) []*pageCounter {
+	counters := make([]*pageCounter, len(outputs))
+	for i := range counters {
+		counters[i] = newPageCounter()
+	}
+	return counters
+}
+
+// Add works of all pages in image file or archive. Pages are numbered in their numbering group of each output.
+// Returns false if ctx is done.
+func addWorks(ctx context.Context, workChan chan <- Work, dir string, filename string, outputs []*output, counters []*pageCounter) bool {
+	// sources of the same book name are not mixed into a book
+	for i, o := range outputs {
+		if o.sink == nil {
+			continue
+		}
+		if err := counters[i].claimBook(o.config, filename); err != nil {
+			log.Printf("Error : %v : %v\n", filename, err)
+			return true
+		}
+	}
+
+	srcFilename := path.Join(dir, filename)
+	src := newSrcFile(srcFilename)
+	pages := []ip.ImagePage{ip.NewImagePage(srcFilename)}
+	if listedPages, err := ip.ListPages(srcFilename); err != nil {
+		// failed file is reported by worker
+		log.Printf("Failed to read pages : %v : %v\n", filename, err)
+	} else {
+		pages = listedPages
+	}
+
+	groupOfs := make([]func(page ip.ImagePage) (string, bool), len(outputs))
+	for i, o := range outputs {
+		groupOfs[i] = pageGroupOf(o.config, o.sink, filename)
+	}
+
+	for _, page := range pages {
+		work := Work{dir, filename, page, make([]workDest, len(outputs)), src}
+		groups := make([]string, len(outputs))
+		for i, groupOf := range groupOfs {
+			group, ordered := groupOf(page)
+			groups[i] = group
+			work.dests[i].index = counters[i].counts[group]
+			if ordered {
+				work.dests[i].book = group
+				counters[i].books[group] = true
+			}
+		}
+
+		select {
+		case workChan <- work:
+			for i, group := range groups {
+				counters[i].counts[group]++
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// Set number of pages of book
+func setBookCount(sink *ip.OrderedSink, book string, count int) {
+	if err := sink.SetCount(book, count); err != nil {
+		log.Printf("Failed to write book : %v : %v\n", book, err)
+	}
 }
 
 type Worker struct {
 	workChan <-chan Work
+	stopCtx  context.Context // done when workers should stop picking up works
+	abortCtx context.Context // done when in-flight works should be abandoned
+	failed   *int32          // number of failed images
+	pipeline *ip.Pipeline    // shared filters
+	outputs  []*output
+	timeout  time.Duration
+	report   *ip.ReportWriter
+	state    *processState
+	dryRun   bool
+}
+
+// check if filename is in any of dirs
+func isInDirs(filename string, dirs []string) bool {
+	for _, dir := range dirs {
+		if ip.IsInDir(filename, dir) {
+			return true
+		}
+	}
+	return false
 }
 
-func collectImages(workChan chan <- Work, finChan chan <- bool, srcDir string, watch bool, watchDelay int) {
+// Collect images until ctx is done. Images are packaged into books if sink of output is not nil.
+func collectImages(ctx context.Context, workChan chan <- Work, finChan chan <- bool, config *Config, outputs []*output) {
 	defer func() {
 		finChan <- true
 	}()
 
-	lastCheckTime := time.Unix(0, 0)
-	var files []os.FileInfo
-	var err error
+	if config.watch {
+		watchImages(ctx, workChan, config, outputs)
+		return
+	}
+
+	srcDir := config.src.dir
+	destDirs := outputDirs(outputs)
 
-	for {
-		// List modified image files
-		files, lastCheckTime, err = ListImages(srcDir, watchDelay, lastCheckTime)
-		if err != nil {
-			log.Println(err)
-			break
+	// List image files
+	files, _, err := ip.ListImages(srcDir, config.src.recursive, config.src.manifest, config.watchDelay, time.Unix(0, 0))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// add works
+	counters := newPageCounters(outputs)
+	for _, file := range files {
+		// skip output files when dest.dir is inside src.dir
+		if filename, err := filepath.Abs(filepath.Join(srcDir, file.Path)); err == nil && isInDirs(filename, destDirs) {
+			continue
 		}
 
-		// add works
-		for _, file := range files {
-			workChan <- Work{srcDir, file.Name(), false}
+		if !addWorks(ctx, workChan, srcDir, file.Path, outputs, counters) {
+			return
 		}
+	}
 
-		if watch {
-			// sleep for a while
-			time.Sleep(time.Duration(5) * time.Second)
-		} else {
-			break
+	// books are written when all pages are processed
+	for i, o := range outputs {
+		for book := range counters[i].books {
+			setBookCount(o.sink, book, counters[i].counts[book])
 		}
 	}
 }
 
-func work(worker Worker, filters []Filter, destDir string, wg *sync.WaitGroup) {
-	defer func() {
-		wg.Done()
-	}()
+// create context of single image processing. timeout 0 means no timeout.
+func newWorkContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
 
-	for {
-		work := <-worker.workChan
-		if work.quit {
-			break
+// Called with report of page when output is written
+type finishFunc func(report *ip.ImageReport, err error)
+
+// Process page and add to book. Failed page is dropped from book. Split pages are added in output order.
+// Pages numbered by {seq} are finished when they are written in order, and the others when they are added to book.
+func addBookPage(ctx context.Context, o *output, work Work, dest workDest, images *ip.PageImages, finish finishFunc) {
+	pages, report, err := o.pipeline.EncodePageImages(ctx, images)
+	if err != nil {
+		pages = nil
+	}
+	for _, page := range pages {
+		page.Fields = ip.NewNameFields(work.page, work.folder(), dest.index, page.Format)
+		page.Fields.Side = page.Side
+	}
+
+	// page failed to be written is finished by either OnWrite or error of sink
+	var once sync.Once
+	finishOnce := func(report *ip.ImageReport, err error) {
+		once.Do(func() {
+			finish(report, err)
+		})
+	}
+
+	sequence := o.config.dest.book == bookNone && len(pages) > 0
+	if sequence {
+		written := 0
+		for i, page := range pages {
+			i := i
+			// parts of page are written in order while sink group is locked
+			page.OnWrite = func(filename string, skipped bool, err error) {
+				if err != nil {
+					report.Error = err.Error()
+					finishOnce(report, err)
+					return
+				}
+				if i == 0 {
+					report.Dest = filename
+					report.Skipped = skipped
+				}
+				if i < len(report.Parts) {
+					report.Parts[i].Dest = filename
+					report.Parts[i].Skipped = skipped
+				}
+				if written++; written == len(pages) {
+					finishOnce(report, nil)
+				}
+			}
 		}
+	}
 
-		log.Printf("[R] %v\n", work.filename)
+	if sinkErr := o.sink.Add(dest.book, dest.index, pages...); sinkErr != nil && err == nil {
+		err = sinkErr
+		report.Error = err.Error()
+	}
+	if sequence && err == nil {
+		return
+	}
+	if !sequence {
+		report.Dest = dest.book
+	}
+	finishOnce(report, err)
+}
 
-		src, err := LoadImage(path.Join(work.dir, work.filename))
-		if err != nil {
-			log.Printf("Error : %v : %v\n", work.filename, err)
-			continue
+// Process images of page by pipeline of output, and write results to dest of output. finish is called with report.
+func writeOutput(ctx context.Context, o *output, work Work, dest workDest, images *ip.PageImages, dryRun bool, finish finishFunc) {
+	if dryRun {
+		finish(o.pipeline.AnalyzePageImages(ctx, images))
+		return
+	}
+	if dest.book != "" {
+		addBookPage(ctx, o, work, dest, images, finish)
+		return
+	}
+
+	destDir := o.config.dest.dir
+	if names := o.config.dest.name; names != nil {
+		fields := ip.NewNameFields(work.page, work.folder(), dest.index, o.pipeline.OutputOption().FormatOf(work.page.Name()))
+		finish(o.pipeline.ProcessPageImagesAs(ctx, images, destDir, func(side string) string {
+			fields.Side = side
+			return names.Format(fields)
+		}))
+		return
+	}
+
+	// mirror directory tree of source
+	finish(o.pipeline.ProcessPageImages(ctx, images, path.Join(destDir, path.Dir(work.filename))))
+}
+
+// Drop page from book or sequence numbering of output
+func dropPage(o *output, dest workDest) {
+	if dest.book == "" {
+		return
+	}
+	if err := o.sink.Add(dest.book, dest.index); err != nil {
+		log.Printf("Failed to write book : %v : %v\n", dest.book, err)
+	}
+}
+
+func (worker Worker) writeReport(report *ip.ImageReport, key string) {
+	if worker.report != nil {
+		if err := worker.report.Write(report); err != nil {
+			log.Printf("Failed to write report : %v : %v\n", key, err)
 		}
+	}
+}
 
-		// run filters
-		var dest image.Image
-		for _, filter := range filters {
-			result := filter.Run(NewFilterSource(src, work.filename))
-			result.Log()
+// Get function writing report and state of output. Pages numbered by {seq} are finished on other workers.
+func (worker Worker) finishOutput(o *output, dest workDest, key string, src *srcFile) finishFunc {
+	return func(report *ip.ImageReport, err error) {
+		report.Branch = o.name
+		worker.writeReport(report, key)
+		if err != nil {
+			log.Printf("Error : %v : %v\n", key, err)
+			atomic.AddInt32(worker.failed, 1)
+			return
+		}
 
-			resultImg := result.Image()
-			if resultImg == nil {
-				log.Printf("Filter result is nil. filter: %v\n", reflect.TypeOf(filter))
-				break
+		if worker.state != nil && o.usesState(dest) {
+			if err := worker.state.Set(key, src, report.Dest); err != nil {
+				log.Printf("Failed to save state : %v : %v\n", key, err)
 			}
+		}
+	}
+}
 
-			dest = resultImg
-			src = dest
+func work(worker Worker, wg *sync.WaitGroup) {
+	defer func() {
+		wg.Done()
+	}()
+
+	for work := range worker.workChan {
+		// drop queued works on shutdown
+		if worker.stopCtx.Err() != nil {
+			break
+		}
+
+		// skip unchanged image in each output. pages of book are always processed.
+		var outputs []int
+		for i, o := range worker.outputs {
+			if worker.state != nil && o.usesState(work.dests[i]) && worker.state.IsProcessed(o.stateKey(work.key()), work.src) {
+				// skipped page is not numbered
+				dropPage(o, work.dests[i])
+				continue
+			}
+			outputs = append(outputs, i)
+		}
+		if len(outputs) == 0 {
+			log.Printf("[S] %v\n", work.key())
+			continue
 		}
 
-		// save dest Image
-		err = SaveJpeg(dest, destDir, work.filename, 80)
+		// source is decoded and shared filters are run once for all outputs
+		ctx, cancel := newWorkContext(worker.abortCtx, worker.timeout)
+		images, report, err := ip.LoadPageImages(work.page)
+		if err == nil {
+			images, report, err = worker.pipeline.RunPageImages(ctx, images)
+		}
 		if err != nil {
-			log.Printf("Error : %v : %v\n", work.filename, err)
+			cancel()
+			// failed page is dropped from books
+			for _, i := range outputs {
+				dropPage(worker.outputs[i], work.dests[i])
+			}
+			worker.writeReport(report, work.key())
+			log.Printf("Error : %v : %v\n", work.key(), err)
+			atomic.AddInt32(worker.failed, 1)
 			continue
 		}
+
+		for _, i := range outputs {
+			o := worker.outputs[i]
+			writeOutput(ctx, o, work, work.dests[i], images, worker.dryRun, worker.finishOutput(o, work.dests[i], o.stateKey(work.key()), work.src))
+		}
+		cancel()
 	}
 }
 
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 	cfgFilename := flag.String("cfg", "", "configuration filename")
 	srcDir := flag.String("src", "./", "source directory")
 	destDir := flag.String("dest", "./output", "dest directory")
 	watch := flag.Bool("watch", false, "watch directory files update")
+	listFilters := flag.Bool("filters", false, "list available filters and their options")
+	listProfiles := flag.Bool("profiles", false, "list device profiles")
+	reportFilename := flag.String("report", "", "processing report filename (.json or .jsonl). '-' writes to stdout")
+	dryRun := flag.Bool("dryRun", false, "run filters and write report only. images are not saved")
 	flag.Parse()
 
 	// Print usage
 	if flag.NFlag() == 1 && flag.Arg(1) == "help" {
 		flag.Usage()
-		return
+		return exitSuccess
+	}
+
+	// Print filters
+	if *listFilters {
+		ip.PrintFilters()
+		return exitSuccess
 	}
 
 	// create Config
 	config := NewConfig(*cfgFilename, *srcDir, *destDir, *watch)
-	config.Print()
+
+	// Print device profiles including profiles of configuration
+	if *listProfiles {
+		ip.PrintDeviceProfiles()
+		return exitSuccess
+	}
+
+	if *reportFilename != "" {
+		config.report = *reportFilename
+	}
+	if *dryRun {
+		config.dryRun = true
+	}
+	if config.dryRun && config.report == "" {
+		config.report = "-"
+	}
+	if config.report == "-" {
+		config.Print(os.Stderr)
+	} else {
+		config.Print(os.Stdout)
+	}
+
+	// open report
+	var reportWriter *ip.ReportWriter
+	switch config.report {
+	case "":
+	case "-":
+		reportWriter = ip.NewReportWriter(os.Stdout, false)
+		defer reportWriter.Close()
+	default:
+		reportFile, err := os.Create(config.report)
+		if err != nil {
+			log.Printf("Failed to create report : %v : %v\n", config.report, err)
+			return exitError
+		}
+		defer reportFile.Close()
+
+		reportWriter = ip.NewReportWriter(reportFile, strings.ToLower(filepath.Ext(config.report)) == ".json")
+		defer reportWriter.Close()
+	}
+
+	// load state
+	var state *processState
+	if config.stateEnabled() {
+		statePath := filepath.Join(config.dest.dir, stateFilename)
+		var err error
+		if state, err = loadProcessState(statePath, config.Hash()); err != nil {
+			log.Printf("Failed to load state : %v : %v\n", statePath, err)
+			return exitError
+		}
+		defer func() {
+			if err := state.Save(); err != nil {
+				log.Printf("Failed to save state : %v\n", err)
+			}
+		}()
+	}
 
 	// set maxProcess
 	runtime.GOMAXPROCS(config.maxProcess)
 
+	// handle signals
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	stopCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	abortCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+
 	// Create channels
 	workChan := make(chan Work, 100)
 	finChan := make(chan bool)
@@ -128,28 +497,105 @@ func main() {
 	// WaitGroup
 	wg := sync.WaitGroup{}
 
+	// dest and branches
+	outputs := newOutputs(config, state)
+
 	// start collector
-	go collectImages(workChan, finChan, config.src.dir, config.watch, config.watchDelay)
+	go collectImages(stopCtx, workChan, finChan, config, outputs)
 
-	var filters []Filter
+	pipeline := ip.NewPipeline()
 	for _, filterOption := range config.filterOptions {
-		filters = append(filters, filterOption.filter)
+		pipeline.Add(filterOption.name, filterOption.filter)
 	}
 
 	// start workers
+	var failed int32
 	for i := 0; i < config.maxProcess; i++ {
-		worker := Worker{workChan}
+		worker := Worker{
+			workChan: workChan,
+			stopCtx:  stopCtx,
+			abortCtx: abortCtx,
+			failed:   &failed,
+			pipeline: pipeline,
+			outputs:  outputs,
+			timeout:  time.Duration(config.timeout) * time.Second,
+			report:   reportWriter,
+			state:    state,
+			dryRun:   config.dryRun,
+		}
 		wg.Add(1)
-		go work(worker, filters, config.dest.dir, &wg)
+		go work(worker, &wg)
+	}
+
+	interrupted, aborted := false, false
+	var deadline <-chan time.Time
+	interrupt := func(sig os.Signal) {
+		log.Printf("Received %v. Waiting for images in progress. Send again to abort.\n", sig)
+		interrupted = true
+		deadline = time.After(time.Duration(config.shutdownTimeout) * time.Second)
+		stop()
 	}
 
 	// wait for collector finish
-	<-finChan
+	select {
+	case <-finChan:
+	case sig := <-signals:
+		interrupt(sig)
+		<-finChan
+	}
 
 	// finish workers
-	for i := 0; i < config.maxProcess; i++ {
-		workChan <- Work{"", "", true}
+	close(workChan)
+
+	workersDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	// wait for workers finish
+	for done := false; !done; {
+		select {
+		case <-workersDone:
+			done = true
+		case sig := <-signals:
+			if !interrupted {
+				interrupt(sig)
+			} else if !aborted {
+				log.Println("Aborting images in progress.")
+				aborted = true
+				abort()
+			} else {
+				log.Println("Exit without waiting images in progress.")
+				return exitInterrupted
+			}
+		case <-deadline:
+			log.Println("Shutdown timeout. Aborting images in progress.")
+			deadline = nil
+			aborted = true
+			abort()
+		}
 	}
 
-	wg.Wait()
+	// remove incomplete books. numbered images are already written.
+	for _, o := range outputs {
+		if o.sink == nil {
+			continue
+		}
+		for _, book := range o.sink.Close() {
+			if o.config.dest.book != bookNone {
+				log.Printf("Incomplete book is not written : %v\n", book)
+			}
+		}
+	}
+
+	// watch mode is stopped only by signal. images in progress are finished on first signal
+	if interrupted && (aborted || !config.watch) {
+		return exitInterrupted
+	}
+	if failed > 0 {
+		log.Printf("Failed images : %v\n", failed)
+		return exitFailed
+	}
+	return exitSuccess
 }
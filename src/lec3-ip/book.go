@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"lec3-ip/ip"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+// Book packaging
+//-----------------------------------------------------------------------------
+
+// book formats of dest.package
+const (
+	bookNone = ""
+	bookCbz  = "cbz"
+	bookEpub = "epub"
+	bookPdf  = "pdf"
+)
+
+func parseBookFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return bookNone, nil
+	case "cbz":
+		return bookCbz, nil
+	case "epub":
+		return bookEpub, nil
+	case "pdf":
+		return bookPdf, nil
+	}
+	return bookNone, errors.New("Unknown dest.package : " + s)
+}
+
+// Book group of image file. Each archive or PDF file is a book, and images in a folder are packaged into a book.
+// Returns empty string if the file is not packaged.
+func bookGroup(filename string, watch bool) string {
+	if ip.IsArchiveFile(filename) || ip.IsPdfFile(filename) {
+		return filename
+	}
+	// folder is never complete in watch mode
+	if watch {
+		return ""
+	}
+	return path.Dir(filename) + "/"
+}
+
+// Book filename of group. ex) vol1/ : dest/vol1.cbz, vol2/book.zip : dest/vol2/book.cbz
+func bookFilename(config *Config, group string) string {
+	ext := "." + config.dest.book
+	if strings.HasSuffix(group, "/") {
+		dir := strings.TrimSuffix(group, "/")
+		if dir == "." {
+			// images in src.dir are named after src.dir
+			absDir, _ := filepath.Abs(config.src.dir)
+			dir = filepath.Base(absDir)
+		}
+		return filepath.Join(config.dest.dir, filepath.FromSlash(dir) + ext)
+	}
+	return filepath.Join(config.dest.dir, filepath.FromSlash(strings.TrimSuffix(group, path.Ext(group))) + ext)
+}
+
+// Book filename of image file in package mode. Returns empty string if the file is not packaged.
+func bookOf(config *Config, filename string) string {
+	group := bookGroup(filename, config.watch)
+	if group == "" {
+		return ""
+	}
+	return bookFilename(config, group)
+}
+
+// Claim book of filename for its source group. Returns error if the book is claimed by another group.
+// ex) folder vol1/ and archive vol1.cbz are both packaged into vol1.cbz
+func (c *pageCounter) claimBook(config *Config, filename string) error {
+	if config.dest.book == bookNone {
+		return nil
+	}
+	group := bookGroup(filename, config.watch)
+	if group == "" {
+		return nil
+	}
+
+	book := bookFilename(config, group)
+	if prev, ok := c.bookGroups[book]; ok && prev != group {
+		return errors.New("Book name is already used by " + prev + " : " + book)
+	}
+	c.bookGroups[book] = group
+	return nil
+}
+
+// Create sink writing books of config.dest.package. Group of sink is book filename.
+func newBookSink(config *Config) *ip.OrderedSink {
+	return ip.NewOrderedSink(func(filename string) (ip.BookWriter, error) {
+		switch config.dest.book {
+		case bookCbz:
+			writer, err := ip.NewCbzWriter(filename, ip.CbzOption{ComicInfo: config.dest.comicInfo, Direction: config.dest.direction})
+			if err != nil {
+				return nil, err
+			}
+			return writer, nil
+		case bookEpub:
+			writer, err := ip.NewEpubWriter(filename, ip.EpubOption{
+				Author:    config.dest.author,
+				Language:  config.dest.language,
+				Direction: config.dest.direction,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return writer, nil
+		case bookPdf:
+			writer, err := ip.NewPdfWriter(filename, ip.PdfOption{
+				Author:    config.dest.author,
+				Direction: config.dest.direction,
+				Dpi:       config.dest.dpi,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return writer, nil
+		}
+		return nil, errors.New("Unknown dest.package : " + config.dest.book)
+	})
+}
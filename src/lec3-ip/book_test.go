@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBookOf(t *testing.T) {
+	config := &Config{
+		src:  SrcOption{dir: "/data/input"},
+		dest: DestOption{dir: "/data/output", book: bookCbz},
+	}
+
+	tests := map[string]string{
+		"01.jpg":          "/data/output/input.cbz",
+		"vol1/01.jpg":     "/data/output/vol1.cbz",
+		"vol1/sub/01.jpg": "/data/output/vol1/sub.cbz",
+		"vol2/book.zip":   "/data/output/vol2/book.cbz",
+	}
+	for filename, expected := range tests {
+		if book := bookOf(config, filename); book != filepath.FromSlash(expected) {
+			t.Errorf("book mismatch. file=%v, expected=%v, actual=%v", filename, expected, book)
+		}
+	}
+
+	// folders are not packaged in watch mode
+	config.watch = true
+	if book := bookOf(config, "vol1/01.jpg"); book != "" {
+		t.Errorf("folder is packaged in watch mode : %v", book)
+	}
+	if book := bookOf(config, "book.cbz"); book != filepath.FromSlash("/data/output/book.cbz") {
+		t.Errorf("archive is not packaged in watch mode : %v", book)
+	}
+}
+
+func TestClaimBook(t *testing.T) {
+	config := &Config{
+		src:  SrcOption{dir: "/data/input"},
+		dest: DestOption{dir: "/data/output", book: bookCbz},
+	}
+
+	counter := newPageCounter()
+	for _, filename := range []string{"vol1/01.jpg", "vol1/02.jpg", "vol2.cbz"} {
+		if err := counter.claimBook(config, filename); err != nil {
+			t.Errorf("claim failed : %v : %v", filename, err)
+		}
+	}
+
+	// archive and folder of the same name
+	for _, filename := range []string{"vol1.cbz", "vol1.pdf", "vol2/01.jpg"} {
+		if err := counter.claimBook(config, filename); err == nil {
+			t.Errorf("expected book name error : %v", filename)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"lec3-ip/ip"
+	"path/filepath"
+)
+
+//-----------------------------------------------------------------------------
+// Output
+//-----------------------------------------------------------------------------
+
+// Output of processed pages. dest and each branch are outputs.
+// Pages are decoded and processed by shared filters once, and then processed by pipeline of each output.
+type output struct {
+	name     string          // branch name. empty for dest
+	config   *Config         // config of output. dest and filters are of the branch
+	pipeline *ip.Pipeline    // filters of branch
+	sink     *ip.OrderedSink // packages images into books, or numbers images in order. nil if not used
+}
+
+// Create outputs of dest and branches. state is nil if process state is not used.
+func newOutputs(config *Config, state *processState) []*output {
+	outputs := []*output{newOutput("", config, nil, state)}
+	for _, branch := range config.branches {
+		branchConfig := *config
+		branchConfig.dest = branch.dest
+		branchConfig.filterOptions = branch.filterOptions
+		branchConfig.branches = nil
+		outputs = append(outputs, newOutput(branch.name, &branchConfig, branch.filterOptions, state))
+	}
+	return outputs
+}
+
+func newOutput(name string, config *Config, filterOptions []FilterOption, state *processState) *output {
+	pipeline := ip.NewPipeline().SetOutputOption(config.dest.OutputOption())
+	for _, filterOption := range filterOptions {
+		pipeline.Add(filterOption.name, filterOption.filter)
+	}
+	// pages are converted for device after filters
+	if config.dest.profile != nil {
+		config.dest.profile.AddFilters(pipeline)
+	}
+
+	// package output images into books, or number output images in order
+	o := &output{name, config, pipeline, nil}
+	if !config.dryRun {
+		if config.dest.book != bookNone {
+			o.sink = newBookSink(config)
+		} else if config.dest.name != nil && config.dest.name.Uses("seq") {
+			o.sink = newSequenceSink(o, state)
+		}
+	}
+	return o
+}
+
+// Key of work in process state of output
+func (o *output) stateKey(key string) string {
+	if o.name == "" {
+		return key
+	}
+	return key + "@" + o.name
+}
+
+// Check if process state is used for page of dest. Pages of book are always processed.
+func (o *output) usesState(dest workDest) bool {
+	return dest.book == "" || o.config.dest.book == bookNone
+}
+
+// Absolute dest directories of outputs
+func outputDirs(outputs []*output) []string {
+	var dirs []string
+	for _, o := range outputs {
+		dir, _ := filepath.Abs(o.config.dest.dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/olebedev/config"
+	"image/png"
+	"io"
+	"lec3-ip/ip"
 	"log"
 	"runtime"
 )
@@ -11,25 +17,63 @@ import (
 type SrcOption struct {
 	dir       string
 	recursive bool
+	manifest  string // filename of manifest listing images of a folder in order
 }
 type DestOption struct {
-	dir string
+	dir            string
+	format         ip.ImageFormat
+	quality        int
+	pngCompression png.CompressionLevel
+	overwrite      ip.OverwritePolicy
+	name           *ip.NameTemplate  // output name template. nil keeps source names
+	profile        *ip.DeviceProfile // e-reader device profile. nil if not used
+	book           string            // dest.package. package output images into a book file of the format
+	comicInfo      bool              // add ComicInfo.xml to cbz
+	direction      string            // page progression direction of book. ltr, rtl
+	language       string            // language of epub
+	author         string            // author of epub and pdf
+	dpi            float64           // resolution of pdf pages without resolution
+}
+
+func (o DestOption) OutputOption() ip.OutputOption {
+	return ip.OutputOption{
+		Format:         o.format,
+		Quality:        o.quality,
+		PngCompression: o.pngCompression,
+		Overwrite:      o.overwrite,
+	}
 }
 
 type FilterOption struct {
-	name   string
-	filter Filter
+	name    string
+	options map[string]interface{}
+	filter  ip.Filter
 }
 
-type Config struct {
-	src           SrcOption
+// Branch of pipeline. Filters of branch are run on result images of shared filters, and results are written to dest of branch.
+type BranchOption struct {
+	name          string
 	dest          DestOption
-	watch         bool
-	watchDelay    int
-	maxProcess    int
 	filterOptions []FilterOption
 }
 
+type Config struct {
+	src             SrcOption
+	dest            DestOption
+	watch           bool
+	watchDelay      int    // seconds of unchanged file size before processing in watch mode
+	watchMode       string // auto, notify, poll
+	pollInterval    int    // directory polling interval in seconds
+	timeout         int    // per-image timeout in seconds. 0 = no timeout
+	shutdownTimeout int    // seconds to wait for images in progress on SIGINT/SIGTERM
+	report          string // report filename. .json: JSON array, '-': stdout, otherwise JSON Lines
+	dryRun          bool   // run filters without saving images
+	state           bool   // skip images processed with same config in previous runs
+	maxProcess      int
+	filterOptions   []FilterOption // shared filters
+	branches        []BranchOption // outputs written in addition to dest
+}
+
 func (c *Config) LoadYaml(filename string) {
 	cfg, err := config.ParseYamlFile(filename)
 	if err != nil {
@@ -37,81 +81,272 @@ func (c *Config) LoadYaml(filename string) {
 		return
 	}
 
-	fmt.Printf("Loading %v\n", filename)
+	log.Printf("Loading %v\n", filename)
 
 	c.src.dir = cfg.UString("src.dir", "")
 	c.src.recursive = cfg.UBool("src.recursive", false)
-	c.dest.dir = cfg.UString("dest.dir", "")
+	c.src.manifest = cfg.UString("src.manifest", "")
+
+	// Load device profiles. Profile of registered name overrides its settings.
+	if profiles, err := cfg.Map("profiles"); err == nil {
+		for name := range profiles {
+			m, _ := cfg.Map("profiles." + name)
+			profile, err := ip.DecodeDeviceProfile(name, m)
+			if err != nil {
+				log.Printf("Failed to read profile : %v : %v\n", name, err)
+				continue
+			}
+			ip.RegisterDeviceProfile(profile)
+		}
+	}
+
+	c.dest.load(cfg, "dest")
 	c.watch = cfg.UBool("watch", false)
 	c.watchDelay = cfg.UInt("watchDelay", 5)
+	c.watchMode = cfg.UString("watchMode", "auto")
+	c.pollInterval = cfg.UInt("pollInterval", 5)
+	c.timeout = cfg.UInt("timeout", 0)
+	c.shutdownTimeout = cfg.UInt("shutdownTimeout", 30)
+	c.report = cfg.UString("report", "")
+	c.dryRun = cfg.UBool("dryRun", false)
+	c.state = cfg.UBool("state", true)
 	c.maxProcess = cfg.UInt("maxProcess", runtime.NumCPU())
 	if c.maxProcess <= 0 {
 		c.maxProcess = runtime.NumCPU()
 	}
 
 	// Load filters
+	c.filterOptions = loadFilterOptions(cfg, "filters")
+
+	// Load branches. dest settings not set in branch are same as dest.
 	for i := 0;; i++ {
-		m, err := cfg.Map(fmt.Sprintf("filters.%v", i))
-		if err != nil {
+		key := fmt.Sprintf("branches.%v", i)
+		if _, err := cfg.Map(key); err != nil {
 			break
 		}
-		name, ok := m["name"]
-		if !ok {
+
+		branch := BranchOption{
+			name: cfg.UString(key + ".name", fmt.Sprintf("branch%v", i + 1)),
+			dest: c.dest,
+		}
+		branch.dest.load(cfg, key + ".dest")
+		if branch.dest.dir == c.dest.dir {
+			log.Printf("Error : %v.dest.dir should be different from dest.dir\n", key)
 			continue
 		}
-
-		c.addFilterOption(name.(string), m["options"].(map[string]interface{}))
+		branch.filterOptions = loadFilterOptions(cfg, key + ".filters")
+		c.branches = append(c.branches, branch)
 	}
 }
 
-func (c *Config) addFilterOption(name string, options map[string]interface{}) {
-	var err error = nil
-	var filter Filter = nil
-
-	switch name {
-	case "deskew":
-		if option, err := NewDeskewOption(options); err == nil {
-			filter = NewDeskewFilter(*option)
+// Load dest settings under key. Settings not in cfg keep current values.
+func (o *DestOption) load(cfg *config.Config, key string) {
+	var err error
+	o.dir = cfg.UString(key + ".dir", o.dir)
+	// format of profile is overridden by format setting
+	if s, e := cfg.String(key + ".profile"); e == nil {
+		if profile, ok := ip.LookupDeviceProfile(s); ok {
+			o.profile = &profile
+			if profile.Format != "" {
+				o.format = profile.Format
+			}
+		} else if s == "none" || s == "" {
+			o.profile = nil
+		} else {
+			log.Printf("Unknown device profile : %v\n", s)
+		}
+	}
+	if s, e := cfg.String(key + ".format"); e == nil {
+		if o.format, err = ip.ParseImageFormat(s); err != nil {
+			log.Println(err)
+		}
+	}
+	if quality := cfg.UInt(key + ".quality", o.quality); quality < 1 || quality > 100 {
+		log.Printf("%v.quality should be 1~100 : %v\n", key, quality)
+	} else {
+		o.quality = quality
+	}
+	if s, e := cfg.String(key + ".pngCompression"); e == nil {
+		if o.pngCompression, err = ip.ParsePngCompression(s); err != nil {
+			log.Println(err)
+		}
+	}
+	if s, e := cfg.String(key + ".overwrite"); e == nil {
+		if o.overwrite, err = ip.ParseOverwritePolicy(s); err != nil {
+			log.Println(err)
 		}
-	case "deskewED":
-		if option, err := NewDeskewEDOption(options); err == nil {
-			filter = NewDeskewEDFilter(*option)
+	}
+	if name := cfg.UString(key + ".name", ""); name != "" {
+		if o.name, err = ip.ParseNameTemplate(name); err != nil {
+			log.Println(err)
 		}
-	case "autoCrop":
-		if option, err := NewAutoCropOption(options); err == nil {
-			filter = NewAutoCropFilter(*option)
+	}
+	if s, e := cfg.String(key + ".package"); e == nil {
+		if o.book, err = parseBookFormat(s); err != nil {
+			log.Println(err)
 		}
-	case "autoCropED":
-		if option, err := NewAutoCropEDOption(options); err == nil {
-			filter = NewAutoCropEDFilter(*option)
+	}
+	o.comicInfo = cfg.UBool(key + ".comicInfo", o.comicInfo)
+	if s, e := cfg.String(key + ".direction"); e == nil {
+		if o.direction, err = ip.ParsePageDirection(s); err != nil {
+			log.Println(err)
 		}
-	default:
-		log.Printf("Unhandled filter name : %v\n", name)
 	}
+	o.language = cfg.UString(key + ".language", o.language)
+	o.author = cfg.UString(key + ".author", o.author)
+	o.dpi = cfg.UFloat64(key + ".dpi", o.dpi)
+}
 
-	if filter != nil {
-		filterOption := FilterOption{
-			name:   name,
-			filter: filter,
+// Load filters in list of key
+func loadFilterOptions(cfg *config.Config, key string) []FilterOption {
+	var filterOptions []FilterOption
+	for i := 0;; i++ {
+		m, err := cfg.Map(fmt.Sprintf("%v.%v", key, i))
+		if err != nil {
+			break
 		}
-		c.filterOptions = append(c.filterOptions, filterOption)
-		fmt.Printf("Filter added : %v\n", name)
+		name, ok := m["name"]
+		if !ok {
+			continue
+		}
+
+		options, _ := m["options"].(map[string]interface{})
+		if filterOption, err := newFilterOption(name.(string), options); err != nil {
+			log.Printf("Failed to read filter : %v : %v\n", name, err)
+		} else {
+			filterOptions = append(filterOptions, filterOption)
+			log.Printf("Filter added : %v\n", name)
+		}
+	}
+	return filterOptions
+}
+
+func newFilterOption(name string, options map[string]interface{}) (FilterOption, error) {
+	filter, err := ip.CreateFilter(name, options)
+	if err != nil {
+		return FilterOption{}, err
+	}
+
+	return FilterOption{
+		name:    name,
+		options: options,
+		filter:  filter,
+	}, nil
+}
+
+// Hash of settings affecting output images. Images are processed again when it is changed.
+func (c *Config) Hash() string {
+	type branchHash struct {
+		Name    string       `json:"name"`
+		Dest    destHash     `json:"dest"`
+		Filters []filterHash `json:"filters"`
+	}
+
+	var branches []branchHash
+	for _, branch := range c.branches {
+		branches = append(branches, branchHash{branch.name, newDestHash(branch.dest), newFilterHashes(branch.filterOptions)})
 	}
+
+	data, err := json.Marshal(struct {
+		Dest     destHash     `json:"dest"`
+		Filters  []filterHash `json:"filters"`
+		Branches []branchHash `json:"branches,omitempty"`
+	}{newDestHash(c.dest), newFilterHashes(c.filterOptions), branches})
 	if err != nil {
-		log.Printf("Failed to read filter : %v : %v\n", name, err)
+		log.Printf("Failed to hash config : %v\n", err)
 	}
+
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
 }
 
-func (c *Config) Print() {
-	fmt.Printf("src.dir : %v\n", c.src.dir)
-	fmt.Printf("dest.dir : %v\n", c.dest.dir)
-	fmt.Printf("watch : %v\n", c.watch)
-	fmt.Printf("maxProcess : %v\n", c.maxProcess)
-	fmt.Printf("filters : %v\n", len(c.filterOptions))
+type filterHash struct {
+	Name    string                 `json:"name"`
+	Options map[string]interface{} `json:"options"`
+}
+
+func newFilterHashes(filterOptions []FilterOption) []filterHash {
+	var filters []filterHash
+	for _, filterOption := range filterOptions {
+		filters = append(filters, filterHash{filterOption.name, filterOption.options})
+	}
+	return filters
+}
+
+type destHash struct {
+	Format         ip.ImageFormat       `json:"format"`
+	Quality        int                  `json:"quality"`
+	PngCompression png.CompressionLevel `json:"pngCompression"`
+	Name           string               `json:"name,omitempty"`
+	Profile        *ip.DeviceProfile    `json:"profile,omitempty"`
+}
+
+func newDestHash(dest DestOption) destHash {
+	name := ""
+	if dest.name != nil {
+		name = dest.name.String()
+	}
+	return destHash{dest.format, dest.quality, dest.pngCompression, name, dest.profile}
+}
+
+// State of previous runs is not used in dry run
+func (c *Config) stateEnabled() bool {
+	return c.state && !c.dryRun
+}
+
+// Print configuration to w. stderr is used when report is written to stdout
+func (c *Config) Print(w io.Writer) {
+	fmt.Fprintf(w, "src.dir : %v\n", c.src.dir)
+	fmt.Fprintf(w, "src.recursive : %v\n", c.src.recursive)
+	if c.src.manifest != "" {
+		fmt.Fprintf(w, "src.manifest : %v\n", c.src.manifest)
+	}
+	fmt.Fprintf(w, "dest.dir : %v\n", c.dest.dir)
+	fmt.Fprintf(w, "dest.format : %v\n", c.dest.format)
+	fmt.Fprintf(w, "dest.quality : %v\n", c.dest.quality)
+	fmt.Fprintf(w, "dest.overwrite : %v\n", c.dest.overwrite)
+	if c.dest.name != nil {
+		fmt.Fprintf(w, "dest.name : %v\n", c.dest.name)
+	}
+	if c.dest.profile != nil {
+		fmt.Fprintf(w, "dest.profile : %v\n", c.dest.profile.Name)
+	}
+	if c.dest.book != bookNone {
+		fmt.Fprintf(w, "dest.package : %v\n", c.dest.book)
+		fmt.Fprintf(w, "dest.direction : %v\n", c.dest.direction)
+	}
+	fmt.Fprintf(w, "watch : %v\n", c.watch)
+	if c.watch {
+		fmt.Fprintf(w, "watchMode : %v\n", c.watchMode)
+	}
+	fmt.Fprintf(w, "maxProcess : %v\n", c.maxProcess)
+	fmt.Fprintf(w, "timeout : %v\n", c.timeout)
+	fmt.Fprintf(w, "report : %v\n", c.report)
+	fmt.Fprintf(w, "dryRun : %v\n", c.dryRun)
+	fmt.Fprintf(w, "state : %v\n", c.stateEnabled())
+	fmt.Fprintf(w, "filters : %v\n", len(c.filterOptions))
+	for _, branch := range c.branches {
+		fmt.Fprintf(w, "branch : %v : %v (filters : %v)\n", branch.name, branch.dest.dir, len(branch.filterOptions))
+	}
 }
 
 func NewConfig(cfgFilename string, srcDir string, destDir string, watch bool) *Config {
-	config := Config{}
+	config := Config{
+		dest: DestOption{
+			format:    ip.FormatJpeg,
+			quality:   80,
+			comicInfo: true,
+			direction: "ltr",
+			language:  "en",
+			dpi:       300,
+		},
+		watchDelay:      5,
+		watchMode:       "auto",
+		pollInterval:    5,
+		maxProcess:      runtime.NumCPU(),
+		state:           true,
+		shutdownTimeout: 30,
+	}
 
 	if cfgFilename != "" {
 		config.LoadYaml(cfgFilename)
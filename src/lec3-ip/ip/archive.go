@@ -0,0 +1,95 @@
+package ip
+
+import (
+	"archive/zip"
+	"errors"
+	"image"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ----------------------------------------------------------------------------
+// Image archive (CBZ/ZIP)
+// ----------------------------------------------------------------------------
+
+// Check if archive entry is an image. Directories and metadata of archivers are skipped.
+func isArchiveImage(file *zip.File) bool {
+	name := file.Name
+	if file.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") {
+		return false
+	}
+	if strings.HasPrefix(path.Base(name), ".") {
+		return false
+	}
+	return isImage(getExt(name))
+}
+
+// Check if archive entry is a relative path in archive.
+// Absolute path, path with volume name and path with '..' could be written outside of dest directory.
+func isSafeEntry(name string) bool {
+	name = strings.Replace(name, "\\", "/", -1)
+	if name == "" || strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// List image entries of archive in natural order. Archive with unsafe entry is rejected.
+func listArchivePages(filename string) ([]ImagePage, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var entries []string
+	for _, file := range reader.File {
+		if !isSafeEntry(file.Name) {
+			return nil, errors.New("Unsafe archive entry : " + file.Name)
+		}
+		if isArchiveImage(file) {
+			entries = append(entries, file.Name)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("No image in archive : " + filename)
+	}
+
+	sort.Sort(naturalStrings(entries))
+
+	var pages []ImagePage
+	for i, entry := range entries {
+		pages = append(pages, ImagePage{filename, i, len(entries), entry})
+	}
+	return pages, nil
+}
+
+// Decode image entry of archive without extracting to disk
+func loadArchiveEntry(filename string, entry string) (image.Image, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name != entry {
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return DecodeImage(r, entry)
+	}
+	return nil, errors.New("Archive entry not found : " + entry)
+}
@@ -0,0 +1,139 @@
+package ip
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Create archive with png entries
+func createTestArchive(t *testing.T, filename string, entries ...string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for _, entry := range entries {
+		f, err := w.Create(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsImageFile(entry) {
+			if err := png.Encode(f, CreateImage(8, 6, color.White)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchivePages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "book.cbz")
+	createTestArchive(t, filename, "10.png", "2.png", "ComicInfo.xml", "__MACOSX/._1.png", "ch1/1.png", "1.png")
+
+	pages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1.png", "2.png", "10.png", "ch1/1.png"}
+	if len(pages) != len(expected) {
+		t.Fatalf("page count mismatch. expected=%v, actual=%v", expected, pages)
+	}
+	for i, page := range pages {
+		if page.Entry != expected[i] || page.Index != i || page.Count != len(expected) {
+			t.Errorf("page mismatch. expected=%v, actual=%v", expected[i], page)
+		}
+	}
+
+	if dir := pages[3].Dir(); dir != "book/ch1" {
+		t.Errorf("dir mismatch. expected=book/ch1, actual=%v", dir)
+	}
+	if name := pages[3].Name(); name != "1.png" {
+		t.Errorf("name mismatch. expected=1.png, actual=%v", name)
+	}
+
+	img, err := pages[2].Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 8 || img.Bounds().Dy() != 6 {
+		t.Errorf("size mismatch : %v", img.Bounds())
+	}
+}
+
+func TestProcessArchivePage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "book.zip")
+	createTestArchive(t, filename, "ch1/01.png")
+
+	pages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	destDir := filepath.Join(dir, "output")
+	report, err := NewPipeline().ProcessPage(context.Background(), pages[0], destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := filepath.Join(destDir, "book", "ch1", "01.jpg")
+	if report.Dest != expected || report.Entry != "ch1/01.png" {
+		t.Errorf("report mismatch. expected dest=%v, actual=%v", expected, report)
+	}
+	if _, err := os.Stat(expected); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArchiveUnsafeEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, entry := range []string{"../../escaped/evil.png", "ch1/../../evil.png", "/tmp/evil.png", "C:/evil.png", "..\\evil.png"} {
+		filename := filepath.Join(dir, fmt.Sprintf("evil%v.cbz", i))
+		createTestArchive(t, filename, "01.png", entry)
+
+		if _, err := ListPages(filename); err == nil {
+			t.Errorf("unsafe entry is listed : %v", entry)
+		}
+	}
+
+	// page of unsafe entry is not written outside of dest directory
+	filename := filepath.Join(dir, "evil.cbz")
+	createTestArchive(t, filename, "../../escaped/evil.png")
+	page := ImagePage{filename, 0, 1, "../../escaped/evil.png"}
+
+	destDir := filepath.Join(dir, "a", "output")
+	if _, err := NewPipeline().ProcessPage(context.Background(), page, destDir); err == nil {
+		t.Error("expected dest directory error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped")); err == nil {
+		t.Error("page is written outside of dest directory")
+	}
+}
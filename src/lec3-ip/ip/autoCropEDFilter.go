@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"github.com/disintegration/gift"
 	"github.com/mitchellh/mapstructure"
 	"image"
@@ -31,6 +32,19 @@ type AutoCropEDOption struct {
 	MaxCropRight         int
 }
 
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "autoCropED",
+		Option: AutoCropEDOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewAutoCropEDOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewAutoCropEDFilter(*option.(*AutoCropEDOption))
+		},
+	})
+}
+
 func NewAutoCropEDOption(m map[string]interface{}) (*AutoCropEDOption, error) {
 	option := AutoCropEDOption{}
 
@@ -53,6 +67,11 @@ func (r AutoCropEDResult) Image() image.Image {
 	return r.image
 }
 
+// Implements CropResult.CropRect()
+func (r AutoCropEDResult) CropRect() image.Rectangle {
+	return r.rect
+}
+
 func (r AutoCropEDResult) Log() {
 }
 
@@ -81,9 +100,12 @@ func NewAutoCropEDFilter(option AutoCropEDOption) *AutoCropEDFilter {
 }
 
 // Implements Filter.Run()
-func (f AutoCropEDFilter) Run(s *FilterSource) FilterResult {
-	img, rect := f.run(s.image)
-	return AutoCropEDResult{img, rect}
+func (f AutoCropEDFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	img, rect := f.run(s.Image)
+	return AutoCropEDResult{img, rect}, nil
 }
 
 // actual autoCrop implementation
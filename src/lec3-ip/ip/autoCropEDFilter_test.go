@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"log"
@@ -9,7 +10,10 @@ import (
 
 func testAutoCropED(t *testing.T, img image.Image, option AutoCropEDOption, expectedWidth, expectedHeight, allowedDelta int) {
 	// Run Filter
-	result := NewAutoCropEDFilter(option).Run(NewFilterSource(img, "filename"))
+	result, err := NewAutoCropEDFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 
 	// Test result image size
 	destBounds := result.Image().Bounds()
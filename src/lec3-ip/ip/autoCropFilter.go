@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"github.com/disintegration/gift"
 	"github.com/mitchellh/mapstructure"
 	"image"
@@ -31,6 +32,19 @@ type AutoCropOption struct {
 	MaxCropRight         int
 }
 
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "autoCrop",
+		Option: AutoCropOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewAutoCropOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewAutoCropFilter(*option.(*AutoCropOption))
+		},
+	})
+}
+
 func NewAutoCropOption(m map[string]interface{}) (*AutoCropOption, error) {
 	option := AutoCropOption{}
 
@@ -51,6 +65,11 @@ func (r AutoCropResult) Image() image.Image {
 	return r.image
 }
 
+// Implements CropResult.CropRect()
+func (r AutoCropResult) CropRect() image.Rectangle {
+	return r.rect
+}
+
 func (r AutoCropResult) Log() {
 }
 
@@ -66,9 +85,12 @@ func NewAutoCropFilter(option AutoCropOption) *AutoCropFilter {
 }
 
 // Implements Filter.Run()
-func (f AutoCropFilter) Run(s *FilterSource) FilterResult {
-	img, rect := f.run(s.image)
-	return AutoCropResult{img, rect}
+func (f AutoCropFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	img, rect := f.run(s.Image)
+	return AutoCropResult{img, rect}, nil
 }
 
 // actual autoCrop implementation
@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"log"
@@ -9,7 +10,10 @@ import (
 
 func testAutoCrop(t *testing.T, img image.Image, option AutoCropOption, expectedWidth, expectedHeight int) {
 	// Run Filter
-	result := NewAutoCropFilter(option).Run(NewFilterSource(img, "filename"))
+	result, err := NewAutoCropFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 
 	// Test result image size
 	destBounds := result.Image().Bounds()
@@ -0,0 +1,230 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"github.com/mitchellh/mapstructure"
+	"image"
+	"image/color"
+	"log"
+	"math"
+)
+
+// binarize methods
+const (
+	BinarizeOtsu    = "otsu"    // global threshold maximizing variance between black and white
+	BinarizeSauvola = "sauvola" // local threshold by mean and standard deviation of window
+	BinarizeNiblack = "niblack" // local threshold by mean and standard deviation of window
+)
+
+// palette of binarized image. index 0 is black, 1 is white.
+var BilevelPalette = color.Palette{color.Black, color.White}
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+type BinarizeOption struct {
+	Method     string  // otsu, sauvola, niblack. default: otsu
+	WindowSize int     // sauvola, niblack : width and height of local window in pixels. default: 31
+	K          float32 // sauvola, niblack : weight of standard deviation. default: 0.34 for sauvola, -0.2 for niblack
+	R          float32 // sauvola : dynamic range of standard deviation. default: 128
+}
+
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "binarize",
+		Option: BinarizeOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewBinarizeOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewBinarizeFilter(*option.(*BinarizeOption))
+		},
+	})
+}
+
+func NewBinarizeOption(m map[string]interface{}) (*BinarizeOption, error) {
+	option := BinarizeOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	switch option.Method {
+	case "", BinarizeOtsu, BinarizeSauvola, BinarizeNiblack:
+	default:
+		return nil, errors.New("Unknown binarize method : " + option.Method)
+	}
+	if option.WindowSize < 0 {
+		return nil, errors.New("windowSize should not be negative")
+	}
+	if option.R < 0 {
+		return nil, errors.New("r should not be negative")
+	}
+
+	return &option, nil
+}
+
+type BinarizeResult struct {
+	image     image.Image
+	filename  string
+	threshold int // global threshold of otsu. -1 for local methods
+}
+
+func (r BinarizeResult) Image() image.Image {
+	return r.image
+}
+
+func (r BinarizeResult) Log() {
+	if r.threshold >= 0 {
+		log.Printf("[BINARIZE] %v : %v\n", r.filename, r.threshold)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// BinarizeFilter converts image to black and white *image.Paletted of BilevelPalette.
+// PNG of binarized image is written in 1 bit depth.
+type BinarizeFilter struct {
+	option BinarizeOption
+}
+
+// Create BinarizeFilter instance
+func NewBinarizeFilter(option BinarizeOption) *BinarizeFilter {
+	if option.Method == "" {
+		option.Method = BinarizeOtsu
+	}
+	if option.WindowSize == 0 {
+		option.WindowSize = 31
+	}
+	if option.K == 0 {
+		if option.Method == BinarizeNiblack {
+			option.K = -0.2
+		} else {
+			option.K = 0.34
+		}
+	}
+	if option.R == 0 {
+		option.R = 128
+	}
+	return &BinarizeFilter{option}
+}
+
+// Implements Filter.Run()
+func (f BinarizeFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	gray := toGrayValues(s.Image)
+	bounds := s.Image.Bounds()
+	dest := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), BilevelPalette)
+
+	if f.option.Method == BinarizeOtsu {
+		threshold := calcOtsuThreshold(gray.Pix)
+		for i, v := range gray.Pix {
+			if int(v) > threshold {
+				dest.Pix[i] = 1
+			}
+		}
+		return BinarizeResult{dest, s.Filename, threshold}, nil
+	}
+
+	f.binarizeLocal(gray, dest)
+	return BinarizeResult{dest, s.Filename, -1}, nil
+}
+
+// Binarize by threshold of local window
+func (f BinarizeFilter) binarizeLocal(gray *image.Gray, dest *image.Paletted) {
+	width, height := gray.Rect.Dx(), gray.Rect.Dy()
+
+	// integral images of sum and squared sum. (width + 1) x (height + 1)
+	stride := width + 1
+	sums := make([]float64, stride * (height + 1))
+	sqSums := make([]float64, stride * (height + 1))
+	for y := 0; y < height; y++ {
+		rowSum, rowSqSum := float64(0), float64(0)
+		for x := 0; x < width; x++ {
+			v := float64(gray.Pix[y * gray.Stride + x])
+			rowSum += v
+			rowSqSum += v * v
+			i := (y + 1) * stride + x + 1
+			sums[i] = sums[i - stride] + rowSum
+			sqSums[i] = sqSums[i - stride] + rowSqSum
+		}
+	}
+
+	k, r := float64(f.option.K), float64(f.option.R)
+	half := f.option.WindowSize / 2
+	for y := 0; y < height; y++ {
+		top, bottom := Max(0, y - half), Min(height, y + half + 1)
+		for x := 0; x < width; x++ {
+			left, right := Max(0, x - half), Min(width, x + half + 1)
+			count := float64((right - left) * (bottom - top))
+			sum := sums[bottom * stride + right] - sums[top * stride + right] - sums[bottom * stride + left] + sums[top * stride + left]
+			sqSum := sqSums[bottom * stride + right] - sqSums[top * stride + right] - sqSums[bottom * stride + left] + sqSums[top * stride + left]
+			mean := sum / count
+			stdDev := math.Sqrt(math.Max(0, sqSum / count - mean * mean))
+
+			var threshold float64
+			if f.option.Method == BinarizeNiblack {
+				threshold = mean + k * stdDev
+			} else {
+				threshold = mean * (1 + k * (stdDev / r - 1))
+			}
+			if float64(gray.Pix[y * gray.Stride + x]) > threshold {
+				dest.Pix[y * dest.Stride + x] = 1
+			}
+		}
+	}
+}
+
+// Gray image of zero origin and stride of width
+func toGrayValues(src image.Image) *image.Gray {
+	bounds := src.Bounds()
+	if gray, ok := src.(*image.Gray); ok && bounds.Min == image.ZP && gray.Stride == bounds.Dx() {
+		return gray
+	}
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			gray.Pix[y * gray.Stride + x] = color.GrayModel.Convert(src.At(bounds.Min.X + x, bounds.Min.Y + y)).(color.Gray).Y
+		}
+	}
+	return gray
+}
+
+// Otsu threshold. values larger than threshold are white.
+func calcOtsuThreshold(values []uint8) int {
+	var histogram [256]int
+	for _, v := range values {
+		histogram[v]++
+	}
+
+	total := float64(len(values))
+	totalSum := float64(0)
+	for v, count := range histogram {
+		totalSum += float64(v * count)
+	}
+
+	threshold := 0
+	maxVariance := float64(-1)
+	darkCount, darkSum := float64(0), float64(0)
+	for v := 0; v < 255; v++ {
+		darkCount += float64(histogram[v])
+		darkSum += float64(v * histogram[v])
+		lightCount := total - darkCount
+		if darkCount == 0 || lightCount == 0 {
+			continue
+		}
+		darkMean := darkSum / darkCount
+		lightMean := (totalSum - darkSum) / lightCount
+		variance := darkCount * lightCount * (darkMean - lightMean) * (darkMean - lightMean)
+		if variance > maxVariance {
+			maxVariance = variance
+			threshold = v
+		}
+	}
+	return threshold
+}
@@ -0,0 +1,98 @@
+package ip
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func runBinarize(t *testing.T, img image.Image, option BinarizeOption) BinarizeResult {
+	result, err := NewBinarizeFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	return result.(BinarizeResult)
+}
+
+// page with background darkening from left (230) to right (100), and dark vertical lines every 20 pixels
+func createShadedPage() *image.RGBA {
+	img := CreateImage(200, 100, color.White)
+	for x := 0; x < 200; x++ {
+		bg := uint8(230 - x * 130 / 199)
+		v := bg
+		if x % 20 >= 8 && x % 20 < 11 {
+			v = bg - 90
+		}
+		FillRect(img, x, 0, x + 1, 100, color.Gray{v})
+	}
+	return img
+}
+
+func isWhite(img image.Image, x, y int) bool {
+	return img.(*image.Paletted).ColorIndexAt(x, y) == 1
+}
+
+func TestBinarizeOtsu(t *testing.T) {
+	img := CreateImage(100, 100, color.Gray{200})
+	FillRect(img, 10, 10, 50, 90, color.Gray{60})
+
+	result := runBinarize(t, img, BinarizeOption{})
+	if result.threshold < 60 || result.threshold >= 200 {
+		t.Errorf("threshold mismatch : %v", result.threshold)
+	}
+	if isWhite(result.Image(), 20, 20) || !isWhite(result.Image(), 80, 80) {
+		t.Error("binarized image mismatch")
+	}
+}
+
+func TestBinarizeLocal(t *testing.T) {
+	img := createShadedPage()
+
+	for _, method := range []string{BinarizeSauvola, BinarizeNiblack} {
+		result := runBinarize(t, img, BinarizeOption{Method: method, WindowSize: 21})
+		for _, x := range []int{3, 100, 183} {
+			if !isWhite(result.Image(), x, 50) {
+				t.Errorf("%v : background at %v is not white", method, x)
+			}
+		}
+		for _, x := range []int{9, 109, 189} {
+			if isWhite(result.Image(), x, 50) {
+				t.Errorf("%v : line at %v is not black", method, x)
+			}
+		}
+	}
+
+	// global threshold fails on shaded background
+	result := runBinarize(t, img, BinarizeOption{})
+	if isWhite(result.Image(), 183, 50) {
+		t.Error("dark background is white in otsu")
+	}
+}
+
+func TestBinarizeBilevelPng(t *testing.T) {
+	result := runBinarize(t, createShadedPage(), BinarizeOption{Method: BinarizeSauvola})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, result.Image()); err != nil {
+		t.Fatal(err)
+	}
+	// bit depth in IHDR chunk
+	if depth := buf.Bytes()[24]; depth != 1 {
+		t.Errorf("png bit depth mismatch : %v", depth)
+	}
+}
+
+func TestBinarizeOption(t *testing.T) {
+	for _, m := range []map[string]interface{}{
+		{"method": "bernsen"},
+		{"windowSize": -1},
+		{"r": -1},
+	} {
+		if _, err := NewBinarizeOption(m); err == nil {
+			t.Errorf("expected option error : %v", m)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package ip
+
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+// ----------------------------------------------------------------------------
+// Book
+// ----------------------------------------------------------------------------
+
+// Encoded page image written to book
+type BookPage struct {
+	Name   string // output filename of page
+	Format ImageFormat
+	Data   []byte
+	Width  int
+	Height int
+	Dpi    float64    // resolution of page image scaled from source image. 0 if unknown
+	Side   string     // side of split page. L or R. empty if page is not split
+	Fields NameFields // fields of output name template
+
+	// called by SequenceWriter with written filename, or existing filename and true if page is skipped. optional
+	OnWrite func(filename string, skipped bool, err error)
+}
+
+// Check if page is a double-page spread
+func (p *BookPage) IsSpread() bool {
+	return p.Width > p.Height
+}
+
+// BookWriter writes pages to a book file in order
+type BookWriter interface {
+	WritePage(page *BookPage) error
+	// Finish book file
+	Close() error
+	// Remove incomplete book file
+	Abort() error
+}
+
+// Create BookWriter of group
+type BookWriterFactory func(group string) (BookWriter, error)
+
+// ----------------------------------------------------------------------------
+// Ordered sink
+// ----------------------------------------------------------------------------
+
+type sinkGroup struct {
+	// guarded by OrderedSink.lock
+	next    int                 // index of next page to write
+	count   int                 // number of pages. -1 if not known yet
+	pending map[int][]*BookPage // pages waiting for previous pages. empty if page is dropped
+
+	// guarded by writeLock. pages are written outside of OrderedSink.lock
+	writeLock sync.Mutex
+	writer    BookWriter
+	dropped   int
+	done      bool // book is finished or aborted
+	err       error
+}
+
+// OrderedSink writes pages of each group to a book in page order.
+// Pages can be added in any order from multiple goroutines. Safe for concurrent use.
+// Pages of different groups are written at the same time.
+type OrderedSink struct {
+	newWriter BookWriterFactory
+	groups    map[string]*sinkGroup
+	lock      sync.Mutex
+}
+
+func NewOrderedSink(newWriter BookWriterFactory) *OrderedSink {
+	return &OrderedSink{
+		newWriter: newWriter,
+		groups:    make(map[string]*sinkGroup),
+	}
+}
+
+func (s *OrderedSink) group(name string) *sinkGroup {
+	g, ok := s.groups[name]
+	if !ok {
+		g = &sinkGroup{count: -1, pending: make(map[int][]*BookPage)}
+		s.groups[name] = g
+	}
+	return g
+}
+
+// Add pages at index of group. Pages of split image share the index, and are written in given order.
+// No page or nil page drops the index (ex: failed to process).
+func (s *OrderedSink) Add(group string, index int, pages ...*BookPage) error {
+	s.lock.Lock()
+	g := s.group(group)
+	if _, ok := g.pending[index]; ok || index < g.next {
+		s.lock.Unlock()
+		return errors.New("Page is already added : " + group)
+	}
+	g.pending[index] = pages
+	s.lock.Unlock()
+
+	return s.flush(group, g)
+}
+
+// Set number of pages in group. Book is finished when all pages are added.
+func (s *OrderedSink) SetCount(group string, count int) error {
+	s.lock.Lock()
+	g := s.group(group)
+	g.count = count
+	s.lock.Unlock()
+
+	return s.flush(group, g)
+}
+
+// Check if book of group is being written
+func (s *OrderedSink) IsWriting(group string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.groups[group]
+	return ok
+}
+
+// Take next page of group if it is added
+func (s *OrderedSink) nextPages(g *sinkGroup) ([]*BookPage, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pages, ok := g.pending[g.next]
+	if ok {
+		delete(g.pending, g.next)
+		g.next++
+	}
+	return pages, ok
+}
+
+// Check if all pages of group are taken. Complete group is removed.
+func (s *OrderedSink) complete(name string, g *sinkGroup) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if g.count < 0 || g.next < g.count {
+		return false
+	}
+	if s.groups[name] == g {
+		delete(s.groups, name)
+	}
+	return true
+}
+
+// write pending pages in order, and finish book if all pages are written
+func (s *OrderedSink) flush(name string, g *sinkGroup) error {
+	g.writeLock.Lock()
+	defer g.writeLock.Unlock()
+
+	if g.done {
+		return g.err
+	}
+
+	for {
+		pages, ok := s.nextPages(g)
+		if !ok {
+			break
+		}
+
+		written := false
+		for _, page := range pages {
+			if page == nil || g.err != nil {
+				continue
+			}
+			if g.writer == nil {
+				if g.writer, g.err = s.newWriter(name); g.err != nil {
+					g.writer = nil
+					continue
+				}
+			}
+			if g.err = g.writer.WritePage(page); g.err == nil {
+				written = true
+			}
+		}
+		if !written {
+			g.dropped++
+		}
+	}
+
+	if !s.complete(name, g) {
+		return g.err
+	}
+
+	// all pages are added
+	g.done = true
+	if g.writer == nil {
+		return g.err
+	}
+	if g.err != nil {
+		g.writer.Abort()
+		return g.err
+	}
+	if g.dropped > 0 {
+		log.Printf("[BOOK] %v : %v of %v pages are dropped\n", name, g.dropped, g.count)
+	}
+	return g.writer.Close()
+}
+
+// Abort books of incomplete groups. Returns names of aborted groups.
+func (s *OrderedSink) Close() []string {
+	s.lock.Lock()
+	groups := s.groups
+	s.groups = make(map[string]*sinkGroup)
+	s.lock.Unlock()
+
+	var aborted []string
+	for name, g := range groups {
+		g.writeLock.Lock()
+		if !g.done {
+			g.done = true
+			if g.writer != nil {
+				g.writer.Abort()
+			}
+			aborted = append(aborted, name)
+		}
+		g.writeLock.Unlock()
+	}
+	return aborted
+}
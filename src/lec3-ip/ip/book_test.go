@@ -0,0 +1,141 @@
+package ip
+
+import (
+	"errors"
+	"testing"
+)
+
+type testBookWriter struct {
+	pages   []string
+	closed  bool
+	aborted bool
+}
+
+func (w *testBookWriter) WritePage(page *BookPage) error {
+	if page.Name == "error" {
+		return errors.New("write error")
+	}
+	w.pages = append(w.pages, page.Name)
+	return nil
+}
+
+func (w *testBookWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func (w *testBookWriter) Abort() error {
+	w.aborted = true
+	return nil
+}
+
+func newTestSink(writers map[string]*testBookWriter) *OrderedSink {
+	return NewOrderedSink(func(group string) (BookWriter, error) {
+		w := &testBookWriter{}
+		writers[group] = w
+		return w, nil
+	})
+}
+
+func TestOrderedSink(t *testing.T) {
+	writers := make(map[string]*testBookWriter)
+	sink := newTestSink(writers)
+
+	// pages are added out of order, and count is known before last page
+	sink.Add("a", 2, &BookPage{Name: "3"})
+	sink.Add("b", 0, &BookPage{Name: "1"})
+	sink.Add("a", 1, nil)
+	sink.SetCount("a", 4)
+	sink.Add("a", 0, &BookPage{Name: "1"})
+	if writers["a"].closed {
+		t.Fatal("book is closed before all pages are added")
+	}
+	if err := sink.Add("a", 3, &BookPage{Name: "4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := writers["a"]
+	if !a.closed || len(a.pages) != 3 || a.pages[0] != "1" || a.pages[1] != "3" || a.pages[2] != "4" {
+		t.Errorf("book mismatch : %v", a)
+	}
+
+	// incomplete book is aborted
+	aborted := sink.Close()
+	if len(aborted) != 1 || aborted[0] != "b" || !writers["b"].aborted {
+		t.Errorf("incomplete book is not aborted : %v", aborted)
+	}
+}
+
+func TestOrderedSinkSplit(t *testing.T) {
+	writers := make(map[string]*testBookWriter)
+	sink := newTestSink(writers)
+
+	// pages of split image share index
+	sink.Add("a", 1, &BookPage{Name: "2R"}, &BookPage{Name: "2L"})
+	sink.Add("a", 0, &BookPage{Name: "1"})
+	if err := sink.SetCount("a", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	a := writers["a"]
+	if !a.closed || len(a.pages) != 3 || a.pages[1] != "2R" || a.pages[2] != "2L" {
+		t.Errorf("book mismatch : %v", a)
+	}
+}
+
+func TestOrderedSinkError(t *testing.T) {
+	writers := make(map[string]*testBookWriter)
+	sink := newTestSink(writers)
+
+	sink.SetCount("a", 2)
+	if err := sink.Add("a", 0, &BookPage{Name: "error"}); err == nil {
+		t.Error("expected write error")
+	}
+	sink.Add("a", 1, &BookPage{Name: "2"})
+
+	a := writers["a"]
+	if a.closed || !a.aborted || len(a.pages) != 0 {
+		t.Errorf("failed book is not aborted : %v", a)
+	}
+}
+
+type blockingBookWriter struct {
+	testBookWriter
+	block chan bool
+}
+
+func (w *blockingBookWriter) WritePage(page *BookPage) error {
+	<-w.block
+	return w.testBookWriter.WritePage(page)
+}
+
+func TestOrderedSinkConcurrent(t *testing.T) {
+	a := &blockingBookWriter{block: make(chan bool)}
+	b := &testBookWriter{}
+	sink := NewOrderedSink(func(group string) (BookWriter, error) {
+		if group == "a" {
+			return a, nil
+		}
+		return b, nil
+	})
+
+	// page of book a is being written
+	done := make(chan error)
+	go func() {
+		done <- sink.Add("a", 0, &BookPage{Name: "1"})
+	}()
+
+	// book b is written while book a is blocked
+	sink.Add("b", 0, &BookPage{Name: "1"})
+	if err := sink.SetCount("b", 1); err != nil || !b.closed {
+		t.Errorf("book is blocked by other book : %v", err)
+	}
+
+	close(a.block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.SetCount("a", 1); err != nil || !a.closed {
+		t.Errorf("book is not closed : %v", err)
+	}
+}
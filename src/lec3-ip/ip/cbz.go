@@ -0,0 +1,146 @@
+package ip
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// CBZ writer
+// ----------------------------------------------------------------------------
+
+type CbzOption struct {
+	ComicInfo bool   // add ComicInfo.xml
+	Title     string // title in ComicInfo.xml
+	Direction string // page progression direction. rtl is marked as manga in ComicInfo.xml
+}
+
+// ComicInfo.xml of ComicRack
+type comicInfo struct {
+	XMLName   xml.Name        `xml:"ComicInfo"`
+	XmlnsXsi  string          `xml:"xmlns:xsi,attr"`
+	XmlnsXsd  string          `xml:"xmlns:xsd,attr"`
+	Title     string          `xml:"Title,omitempty"`
+	PageCount int             `xml:"PageCount"`
+	Manga     string          `xml:"Manga,omitempty"`
+	Pages     []comicInfoPage `xml:"Pages>Page"`
+}
+
+type comicInfoPage struct {
+	Image       int    `xml:"Image,attr"`
+	Type        string `xml:"Type,attr,omitempty"`
+	DoublePage  bool   `xml:"DoublePage,attr,omitempty"`
+	ImageSize   int    `xml:"ImageSize,attr"`
+	ImageWidth  int    `xml:"ImageWidth,attr"`
+	ImageHeight int    `xml:"ImageHeight,attr"`
+}
+
+// CbzWriter writes pages to CBZ file. Entries are named by page number to keep order in readers. ex) 0001.jpg
+type CbzWriter struct {
+	file   *AtomicFile
+	zip    *zip.Writer
+	option CbzOption
+	pages  []comicInfoPage
+}
+
+func NewCbzWriter(filename string, option CbzOption) (*CbzWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	file, err := CreateAtomicFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if option.Title == "" {
+		option.Title = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	return &CbzWriter{file: file, zip: zip.NewWriter(file), option: option}, nil
+}
+
+func (w *CbzWriter) createEntry(name string, method uint16) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: method}
+	header.SetModTime(time.Now())
+	return w.zip.CreateHeader(header)
+}
+
+func (w *CbzWriter) WritePage(page *BookPage) error {
+	index := len(w.pages)
+	name := fmt.Sprintf("%04d%v", index + 1, page.Format.Ext())
+
+	// images are already compressed
+	entry, err := w.createEntry(name, zip.Store)
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(page.Data); err != nil {
+		return err
+	}
+
+	infoPage := comicInfoPage{
+		Image:       index,
+		DoublePage:  page.IsSpread(),
+		ImageSize:   len(page.Data),
+		ImageWidth:  page.Width,
+		ImageHeight: page.Height,
+	}
+	if index == 0 {
+		infoPage.Type = "FrontCover"
+	}
+	w.pages = append(w.pages, infoPage)
+	return nil
+}
+
+func (w *CbzWriter) writeComicInfo() error {
+	info := comicInfo{
+		XmlnsXsi:  "http://www.w3.org/2001/XMLSchema-instance",
+		XmlnsXsd:  "http://www.w3.org/2001/XMLSchema",
+		Title:     w.option.Title,
+		PageCount: len(w.pages),
+		Pages:     w.pages,
+	}
+	if w.option.Direction == "rtl" {
+		info.Manga = "YesAndRightToLeft"
+	}
+
+	entry, err := w.createEntry("ComicInfo.xml", zip.Deflate)
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(entry)
+	encoder.Indent("", "  ")
+	return encoder.Encode(info)
+}
+
+func (w *CbzWriter) Close() error {
+	if w.option.ComicInfo {
+		if err := w.writeComicInfo(); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	if err := w.zip.Close(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.file.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("[BOOK] %v : %v pages\n", w.file.filename, len(w.pages))
+	return nil
+}
+
+func (w *CbzWriter) Abort() error {
+	return w.file.Abort()
+}
@@ -0,0 +1,65 @@
+package ip
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCbzWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "book.cbz")
+	w, err := NewCbzWriter(filename, CbzOption{ComicInfo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WritePage(&BookPage{Name: "cover.jpg", Format: FormatJpeg, Data: []byte("cover"), Width: 600, Height: 800})
+	w.WritePage(&BookPage{Name: "spread.png", Format: FormatPng, Data: []byte("spread"), Width: 1200, Height: 800})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expected := []string{"0001.jpg", "0002.png", "ComicInfo.xml"}
+	if len(reader.File) != len(expected) {
+		t.Fatalf("entry count mismatch. expected=%v, actual=%v", len(expected), len(reader.File))
+	}
+	for i, file := range reader.File {
+		if file.Name != expected[i] {
+			t.Errorf("entry mismatch. expected=%v, actual=%v", expected[i], file.Name)
+		}
+	}
+
+	r, err := reader.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+
+	info := string(data)
+	for _, s := range []string{"<Title>book</Title>", "<PageCount>2</PageCount>", `Type="FrontCover"`, `DoublePage="true"`, `ImageWidth="1200"`} {
+		if !strings.Contains(info, s) {
+			t.Errorf("ComicInfo.xml does not contain %v :\n%v", s, info)
+		}
+	}
+
+	// temp file is removed
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("file count mismatch. expected=1, actual=%v", len(files))
+	}
+}
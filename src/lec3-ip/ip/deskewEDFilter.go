@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"github.com/disintegration/gift"
 	"github.com/mitchellh/mapstructure"
 	"image"
@@ -19,6 +20,19 @@ type DeskewEDOption struct {
 	Threshold            uint8   // edge strength threshold (0~255(max edge))
 }
 
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "deskewED",
+		Option: DeskewEDOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewDeskewEDOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewDeskewEDFilter(*option.(*DeskewEDOption))
+		},
+	})
+}
+
 func NewDeskewEDOption(m map[string]interface{}) (*DeskewEDOption, error) {
 	option := DeskewEDOption{}
 
@@ -40,6 +54,11 @@ func (r DeskewEDResult) Image() image.Image {
 	return r.image
 }
 
+// Implements RotateResult.RotatedAngle()
+func (r DeskewEDResult) RotatedAngle() float32 {
+	return r.rotatedAngle
+}
+
 func (r DeskewEDResult) Log() {
 	if r.rotatedAngle != 0 {
 		log.Printf("[ROTATE] %v : %.1f", r.filename, r.rotatedAngle)
@@ -74,22 +93,29 @@ func NewDeskewEDFilter(option DeskewEDOption) *DeskewEDFilter {
 }
 
 // Implements Filter.Run()
-func (f DeskewEDFilter) Run(s *FilterSource) FilterResult {
-	resultImage, rotatedAngle := f.run(s.image, s.filename)
-	return DeskewEDResult{resultImage, s.filename, rotatedAngle}
+func (f DeskewEDFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	resultImage, rotatedAngle, err := f.run(ctx, s.Image, s.Filename)
+	if err != nil {
+		return nil, err
+	}
+	return DeskewEDResult{resultImage, s.Filename, rotatedAngle}, nil
 }
 
 // actual deskew implementation
-func (f DeskewEDFilter) run(src image.Image, name string) (image.Image, float32) {
+func (f DeskewEDFilter) run(ctx context.Context, src image.Image, name string) (image.Image, float32, error) {
 	// Edge Detect Image
 	edImg := image.NewGray(src.Bounds())
 	f.edgeDetect.Draw(edImg, src)
 
 	// Find preferred rotation angle
-	if angle := f.detectAngle(edImg, name); angle != 0 {
-		return f.rotateImage(src, angle), angle
+	angle, err := f.detectAngle(ctx, edImg, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if angle != 0 {
+		return f.rotateImage(src, angle), angle, nil
 	}
-	return src, 0
+	return src, 0, nil
 }
 
 // Rotate image
@@ -104,7 +130,7 @@ func (f DeskewEDFilter) rotateImage(src image.Image, angle float32) image.Image
 }
 
 // Detect rotation angle
-func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
+func (f DeskewEDFilter) detectAngle(ctx context.Context, edImg *image.Gray, name string) (float32, error) {
 	minNonEmptyLineCount := f.calcNonEmptyLineCount(edImg, 0, name)
 
 	// increase rotation angle by incrStep
@@ -118,6 +144,10 @@ func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
 	incrStep := f.option.IncrStep
 	if incrStep > 0 {
 		for angle := incrStep; angle <= f.option.MaxRotation; angle += incrStep {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+
 			if positiveDir {
 				nonEmptyLineCount := f.calcNonEmptyLineCount(edImg, angle, name)
 
@@ -148,7 +178,7 @@ func (f DeskewEDFilter) detectAngle(edImg *image.Gray, name string) float32 {
 		log.Printf("detected angle %v\n", detectedAngle)
 	}
 
-	return detectedAngle
+	return detectedAngle, nil
 }
 
 func (f DeskewEDFilter) calcNonEmptyLineCount(edImg *image.Gray, angle float32, name string) int {
@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"testing"
@@ -8,7 +9,10 @@ import (
 
 func testDeskewED(t *testing.T, img image.Image, option DeskewEDOption, rotatedAngleMin, rotatedAngleMax float32) {
 	// Run Filter
-	result := NewDeskewEDFilter(option).Run(NewFilterSource(img, "filename"))
+	result, err := NewDeskewEDFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 	rotatedAngle := result.(DeskewEDResult).rotatedAngle
 
 	// Test result image size
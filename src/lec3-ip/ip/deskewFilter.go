@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"github.com/disintegration/gift"
 	"github.com/mitchellh/mapstructure"
 	"image"
@@ -20,6 +21,19 @@ type DeskewOption struct {
 	Threshold            uint8   // min brightness of space (0~255)
 }
 
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "deskew",
+		Option: DeskewOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewDeskewOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewDeskewFilter(*option.(*DeskewOption))
+		},
+	})
+}
+
 func NewDeskewOption(m map[string]interface{}) (*DeskewOption, error) {
 	option := DeskewOption{}
 
@@ -41,6 +55,11 @@ func (r DeskewResult) Image() image.Image {
 	return r.image
 }
 
+// Implements RotateResult.RotatedAngle()
+func (r DeskewResult) RotatedAngle() float32 {
+	return r.rotatedAngle
+}
+
 func (r DeskewResult) Log() {
 	if r.rotatedAngle != 0 {
 		log.Printf("[ROTATE] %v : %.1f", r.filename, r.rotatedAngle)
@@ -60,13 +79,16 @@ func NewDeskewFilter(option DeskewOption) *DeskewFilter {
 }
 
 // Implements Filter.Run()
-func (f DeskewFilter) Run(s *FilterSource) FilterResult {
-	resultImage, rotatedAngle := f.run(s.image, s.filename)
-	return DeskewResult{resultImage, s.filename, rotatedAngle}
+func (f DeskewFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	resultImage, rotatedAngle, err := f.run(ctx, s.Image, s.Filename)
+	if err != nil {
+		return nil, err
+	}
+	return DeskewResult{resultImage, s.Filename, rotatedAngle}, nil
 }
 
 // actual deskew implementation
-func (f DeskewFilter) run(src image.Image, name string) (image.Image, float32) {
+func (f DeskewFilter) run(ctx context.Context, src image.Image, name string) (image.Image, float32, error) {
 	bounds := src.Bounds()
 	var rgba *image.RGBA
 
@@ -78,10 +100,14 @@ func (f DeskewFilter) run(src image.Image, name string) (image.Image, float32) {
 		draw.Draw(rgba, bounds, src, bounds.Min, draw.Src)
 	}
 
-	if angle := f.detectAngle(rgba, name); angle != 0 {
-		return f.rotateImage(rgba, angle), angle
+	angle, err := f.detectAngle(ctx, rgba, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if angle != 0 {
+		return f.rotateImage(rgba, angle), angle, nil
 	}
-	return src, 0
+	return src, 0, nil
 }
 
 // Rotate image
@@ -95,7 +121,7 @@ func (f DeskewFilter) rotateImage(src image.Image, angle float32) image.Image {
 	return dest
 }
 
-func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
+func (f DeskewFilter) detectAngle(ctx context.Context, src *image.RGBA, name string) (float32, error) {
 	minNonEmptyLineCount := f.calcNonEmptyLineCount(src, 0, name)
 
 	// increase rotation angle by incrStep
@@ -109,6 +135,10 @@ func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
 	incrStep := f.option.IncrStep
 	if incrStep > 0 {
 		for angle := incrStep; angle <= f.option.MaxRotation; angle += incrStep {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+
 			if positiveDir {
 				nonEmptyLineCount := f.calcNonEmptyLineCount(src, angle, name)
 
@@ -135,7 +165,7 @@ func (f DeskewFilter) detectAngle(src *image.RGBA, name string) float32 {
 		}
 	}
 
-	return detectedAngle
+	return detectedAngle, nil
 }
 
 func (f DeskewFilter) calcNonEmptyLineCount(src *image.RGBA, angle float32, name string) int {
@@ -1,6 +1,7 @@
-package main
+package ip
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"testing"
@@ -8,7 +9,10 @@ import (
 
 func testDeskew(t *testing.T, img image.Image, option DeskewOption, rotatedAngleMin, rotatedAngleMax float32) {
 	// Run Filter
-	result := NewDeskewFilter(option).Run(NewFilterSource(img, "filename"))
+	result, err := NewDeskewFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
 	rotatedAngle := result.(DeskewResult).rotatedAngle
 
 	// Test result image size
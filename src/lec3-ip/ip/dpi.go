@@ -0,0 +1,207 @@
+package ip
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// ----------------------------------------------------------------------------
+// Image resolution
+// ----------------------------------------------------------------------------
+
+// maximum bytes read from archive entry to find resolution
+const maxDpiHeaderSize = 1 << 20
+
+const inchPerMeter = 0.0254
+
+// Resolution of page in dots per inch. Returns 0 if resolution is not found in source file.
+func (p ImagePage) Dpi() float64 {
+	if p.Entry == "" && isPdf(getExt(p.Filename)) {
+		return readPdfDpi(p.Filename, p.Index)
+	}
+
+	var r io.ReaderAt
+	name := p.Filename
+
+	if p.Entry != "" {
+		data, err := readArchiveEntryHeader(p.Filename, p.Entry)
+		if err != nil {
+			return 0
+		}
+		r = bytes.NewReader(data)
+		name = p.Entry
+	} else {
+		file, err := os.Open(p.Filename)
+		if err != nil {
+			return 0
+		}
+		defer file.Close()
+		r = file
+	}
+
+	switch getExt(name) {
+	case ".jpg", ".jpeg":
+		return readJpegDpi(r)
+	case ".png":
+		return readPngDpi(r)
+	case ".tif", ".tiff":
+		if p.Entry != "" {
+			return readTiffDpi(r, 0)
+		}
+		return readTiffDpi(r, p.Index)
+	case ".bmp":
+		return readBmpDpi(r)
+	}
+	return 0
+}
+
+func readArchiveEntryHeader(filename string, entry string) ([]byte, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name != entry {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(io.LimitReader(r, maxDpiHeaderSize))
+	}
+	return nil, os.ErrNotExist
+}
+
+// Read density of JFIF APP0 segment
+func readJpegDpi(r io.ReaderAt) float64 {
+	buf := make([]byte, 16)
+	offset := int64(2) // SOI
+	for {
+		if _, err := r.ReadAt(buf[0:4], offset); err != nil || buf[0] != 0xff {
+			return 0
+		}
+		marker := buf[1]
+		length := int64(binary.BigEndian.Uint16(buf[2:4]))
+
+		// start of scan
+		if marker == 0xda {
+			return 0
+		}
+		if marker == 0xe0 && length >= 14 {
+			if _, err := r.ReadAt(buf[0:12], offset + 4); err != nil {
+				return 0
+			}
+			if string(buf[0:5]) != "JFIF\x00" {
+				return 0
+			}
+			density := float64(binary.BigEndian.Uint16(buf[8:10]))
+			switch buf[7] {
+			case 1:
+				return density
+			case 2:
+				return density * 2.54
+			}
+			return 0
+		}
+		offset += 2 + length
+	}
+}
+
+// Read pHYs chunk
+func readPngDpi(r io.ReaderAt) float64 {
+	buf := make([]byte, 9)
+	offset := int64(8) // signature
+	for {
+		if _, err := r.ReadAt(buf[0:8], offset); err != nil {
+			return 0
+		}
+		length := int64(binary.BigEndian.Uint32(buf[0:4]))
+		chunkType := string(buf[4:8])
+
+		if chunkType == "IDAT" || chunkType == "IEND" {
+			return 0
+		}
+		if chunkType == "pHYs" && length == 9 {
+			if _, err := r.ReadAt(buf, offset + 8); err != nil {
+				return 0
+			}
+			// unit 1 : meter
+			if buf[8] != 1 {
+				return 0
+			}
+			return float64(binary.BigEndian.Uint32(buf[0:4])) * inchPerMeter
+		}
+		// length, type, data, crc
+		offset += 12 + length
+	}
+}
+
+// Read XResolution and ResolutionUnit tags of page
+func readTiffDpi(r io.ReaderAt, page int) float64 {
+	t, err := newTiffFile(r)
+	if err != nil {
+		return 0
+	}
+	offsets, err := t.ifdOffsets()
+	if err != nil || page >= len(offsets) {
+		return 0
+	}
+
+	offset := int64(offsets[page])
+	buf := make([]byte, 12)
+	if _, err := r.ReadAt(buf[0:2], offset); err != nil {
+		return 0
+	}
+	entryCount := int(t.byteOrder.Uint16(buf[0:2]))
+
+	var resolution float64
+	unit := uint16(2) // inch
+	for i := 0; i < entryCount; i++ {
+		if _, err := r.ReadAt(buf, offset + 2 + int64(i) * 12); err != nil {
+			return 0
+		}
+		switch t.byteOrder.Uint16(buf[0:2]) {
+		case 282:
+			// RATIONAL value is stored at offset
+			value := make([]byte, 8)
+			if _, err := r.ReadAt(value, int64(t.byteOrder.Uint32(buf[8:12]))); err != nil {
+				return 0
+			}
+			numerator, denominator := t.byteOrder.Uint32(value[0:4]), t.byteOrder.Uint32(value[4:8])
+			if denominator != 0 {
+				resolution = float64(numerator) / float64(denominator)
+			}
+		case 296:
+			unit = t.byteOrder.Uint16(buf[8:10])
+		}
+	}
+
+	switch unit {
+	case 2:
+		return resolution
+	case 3:
+		return resolution * 2.54
+	}
+	return 0
+}
+
+// Read horizontal resolution of BITMAPINFOHEADER
+func readBmpDpi(r io.ReaderAt) float64 {
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, 38); err != nil {
+		return 0
+	}
+	pixelsPerMeter := int32(binary.LittleEndian.Uint32(buf))
+	if pixelsPerMeter <= 0 {
+		return 0
+	}
+	return float64(pixelsPerMeter) * inchPerMeter
+}
@@ -0,0 +1,33 @@
+package ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadDpi(t *testing.T) {
+	// JFIF APP0 with 2 units (dots per cm)
+	jfif := []byte{0xff, 0xd8, 0xff, 0xe0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 2, 0, 100, 0, 100, 0, 0, 0xff, 0xda}
+	if dpi := readJpegDpi(bytes.NewReader(jfif)); dpi != 254 {
+		t.Errorf("jpeg dpi mismatch. expected=254, actual=%v", dpi)
+	}
+
+	// pHYs chunk in pixels per meter
+	pngData := []byte("\x89PNG\r\n\x1a\n")
+	pngData = append(pngData, 0, 0, 0, 9, 'p', 'H', 'Y', 's')
+	pngData = append(pngData, 0, 0, 0x2e, 0x23, 0, 0, 0x2e, 0x23, 1, 0, 0, 0, 0)
+	if dpi := readPngDpi(bytes.NewReader(pngData)); dpi < 299.9 || dpi > 300.1 {
+		t.Errorf("png dpi mismatch. expected=300, actual=%v", dpi)
+	}
+
+	bmp := make([]byte, 54)
+	binary.LittleEndian.PutUint32(bmp[38:], 23622)
+	if dpi := readBmpDpi(bytes.NewReader(bmp)); dpi < 599.9 || dpi > 600.1 {
+		t.Errorf("bmp dpi mismatch. expected=600, actual=%v", dpi)
+	}
+
+	if dpi := readJpegDpi(bytes.NewReader([]byte{0xff, 0xd8, 0xff, 0xda})); dpi != 0 {
+		t.Errorf("unknown dpi should be 0 : %v", dpi)
+	}
+}
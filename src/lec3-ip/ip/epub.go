@@ -0,0 +1,285 @@
+package ip
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// EPUB writer
+// ----------------------------------------------------------------------------
+
+type EpubOption struct {
+	Title     string // default : book filename
+	Author    string
+	Language  string // default : en
+	Direction string // page progression direction. ltr or rtl (ex: manga)
+}
+
+func ParsePageDirection(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "ltr", "":
+		return "ltr", nil
+	case "rtl":
+		return "rtl", nil
+	}
+	return "ltr", errors.New("Unknown page direction : " + s)
+}
+
+type epubPage struct {
+	id     string // ex) p0001
+	image  string // image path in OEBPS. ex) images/0001.jpg
+	format ImageFormat
+	width  int
+	height int
+}
+
+// EpubWriter writes pages to fixed-layout EPUB 3 file.
+// Each page is a XHTML document with viewport of its image size. First page is the cover.
+type EpubWriter struct {
+	file   *AtomicFile
+	zip    *zip.Writer
+	option EpubOption
+	pages  []epubPage
+}
+
+func NewEpubWriter(filename string, option EpubOption) (*EpubWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	file, err := CreateAtomicFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if option.Title == "" {
+		option.Title = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	if option.Language == "" {
+		option.Language = "en"
+	}
+	if option.Direction == "" {
+		option.Direction = "ltr"
+	}
+
+	w := &EpubWriter{file: file, zip: zip.NewWriter(file), option: option}
+
+	if err := w.writeMimetype(); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	if err := w.writeEntry("META-INF/container.xml", zip.Deflate, []byte(epubContainer)); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// mimetype should be the first entry without compression, extra field and data descriptor.
+// Its content starts at offset 38 of the file.
+func (w *EpubWriter) writeMimetype() error {
+	data := []byte("application/epub+zip")
+	header := &zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+	}
+	entry, err := w.zip.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
+
+func (w *EpubWriter) writeEntry(name string, method uint16, data []byte) error {
+	header := &zip.FileHeader{Name: name, Method: method}
+	header.SetModTime(time.Now())
+	entry, err := w.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
+
+func escapeXml(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func mediaType(format ImageFormat) string {
+	switch format {
+	case FormatPng:
+		return "image/png"
+	case FormatGif:
+		return "image/gif"
+	}
+	return "image/jpeg"
+}
+
+func (w *EpubWriter) WritePage(page *BookPage) error {
+	index := len(w.pages)
+	p := epubPage{
+		id:     fmt.Sprintf("p%04d", index + 1),
+		image:  fmt.Sprintf("images/%04d%v", index + 1, page.Format.Ext()),
+		format: page.Format,
+		width:  page.Width,
+		height: page.Height,
+	}
+
+	// images are already compressed
+	if err := w.writeEntry("OEBPS/" + p.image, zip.Store, page.Data); err != nil {
+		return err
+	}
+
+	var xhtml bytes.Buffer
+	fmt.Fprintf(&xhtml, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+  <title>%v</title>
+  <meta name="viewport" content="width=%v, height=%v"/>
+  <style>body { margin: 0; } img { position: absolute; left: 0; top: 0; width: %vpx; height: %vpx; }</style>
+</head>
+<body>
+  <img src="../%v" alt="%v"/>
+</body>
+</html>
+`, escapeXml(w.option.Title), p.width, p.height, p.width, p.height, p.image, p.id)
+	if err := w.writeEntry("OEBPS/pages/" + p.id + ".xhtml", zip.Deflate, xhtml.Bytes()); err != nil {
+		return err
+	}
+
+	w.pages = append(w.pages, p)
+	return nil
+}
+
+// Random UUID version 4
+func newUuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func (w *EpubWriter) writePackage() error {
+	uuid, err := newUuid()
+	if err != nil {
+		return err
+	}
+
+	var opf bytes.Buffer
+	fmt.Fprintf(&opf, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:uuid:%v</dc:identifier>
+    <dc:title>%v</dc:title>
+    <dc:language>%v</dc:language>
+`, uuid, escapeXml(w.option.Title), escapeXml(w.option.Language))
+	if w.option.Author != "" {
+		fmt.Fprintf(&opf, "    <dc:creator>%v</dc:creator>\n", escapeXml(w.option.Author))
+	}
+	fmt.Fprintf(&opf, `    <meta property="dcterms:modified">%v</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">auto</meta>
+    <meta property="rendition:spread">landscape</meta>
+    <meta name="cover" content="img-p0001"/>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+`, time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+
+	for i, p := range w.pages {
+		properties := ""
+		if i == 0 {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&opf, "    <item id=\"img-%v\" href=\"%v\" media-type=\"%v\"%v/>\n", p.id, p.image, mediaType(p.format), properties)
+		fmt.Fprintf(&opf, "    <item id=\"%v\" href=\"pages/%v.xhtml\" media-type=\"application/xhtml+xml\"/>\n", p.id, p.id)
+	}
+
+	fmt.Fprintf(&opf, "  </manifest>\n  <spine page-progression-direction=\"%v\">\n", w.option.Direction)
+	for i, p := range w.pages {
+		// cover is a single page. spreads start from the left page in ltr, and the right page in rtl.
+		spread := "page-spread-right"
+		if (i % 2 == 1) == (w.option.Direction != "rtl") {
+			spread = "page-spread-left"
+		}
+		if i == 0 {
+			spread = "rendition:page-spread-center"
+		}
+		fmt.Fprintf(&opf, "    <itemref idref=\"%v\" properties=\"%v\"/>\n", p.id, spread)
+	}
+	opf.WriteString("  </spine>\n</package>\n")
+
+	if err := w.writeEntry("OEBPS/content.opf", zip.Deflate, opf.Bytes()); err != nil {
+		return err
+	}
+
+	var nav bytes.Buffer
+	fmt.Fprintf(&nav, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%v</title></head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <ol>
+      <li><a href="pages/p0001.xhtml">%v</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+`, escapeXml(w.option.Title), escapeXml(w.option.Title))
+	return w.writeEntry("OEBPS/nav.xhtml", zip.Deflate, nav.Bytes())
+}
+
+func (w *EpubWriter) Close() error {
+	if len(w.pages) == 0 {
+		w.Abort()
+		return errors.New("EPUB has no page")
+	}
+	if err := w.writePackage(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.zip.Close(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.file.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("[BOOK] %v : %v pages\n", w.file.filename, len(w.pages))
+	return nil
+}
+
+func (w *EpubWriter) Abort() error {
+	return w.file.Abort()
+}
@@ -0,0 +1,102 @@
+package ip
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readZipEntry(t *testing.T, file *zip.File) string {
+	r, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEpubWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "manga.epub")
+	w, err := NewEpubWriter(filename, EpubOption{Direction: "rtl", Language: "ja"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.WritePage(&BookPage{Format: FormatJpeg, Data: []byte("jpeg"), Width: 600 + i, Height: 800}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	// mimetype is the first entry without compression
+	mimetype := reader.File[0]
+	if mimetype.Name != "mimetype" || mimetype.Method != zip.Store || readZipEntry(t, mimetype) != "application/epub+zip" {
+		t.Errorf("invalid mimetype entry : %v", mimetype.Name)
+	}
+
+	// mimetype content starts at offset 38 of OCF container
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := string(data[30:58]); header != "mimetypeapplication/epub+zip" {
+		t.Errorf("invalid mimetype header : %q", header)
+	}
+	if flags := binary.LittleEndian.Uint16(data[6:8]); flags & 0x8 != 0 {
+		t.Errorf("mimetype has data descriptor : %x", flags)
+	}
+
+	entries := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		entries[file.Name] = file
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/images/0003.jpg"} {
+		if entries[name] == nil {
+			t.Fatalf("entry not found : %v", name)
+		}
+	}
+
+	opf := readZipEntry(t, entries["OEBPS/content.opf"])
+	for _, s := range []string{
+		`<dc:title>manga</dc:title>`,
+		`<dc:language>ja</dc:language>`,
+		`<meta property="rendition:layout">pre-paginated</meta>`,
+		`href="images/0001.jpg" media-type="image/jpeg" properties="cover-image"`,
+		`<spine page-progression-direction="rtl">`,
+		`<itemref idref="p0001" properties="rendition:page-spread-center"/>
+    <itemref idref="p0002" properties="page-spread-right"/>
+    <itemref idref="p0003" properties="page-spread-left"/>`,
+	} {
+		if !strings.Contains(opf, s) {
+			t.Errorf("content.opf does not contain %v :\n%v", s, opf)
+		}
+	}
+
+	page := readZipEntry(t, entries["OEBPS/pages/p0002.xhtml"])
+	if !strings.Contains(page, `<meta name="viewport" content="width=601, height=800"/>`) {
+		t.Errorf("invalid viewport :\n%v", page)
+	}
+}
@@ -0,0 +1,171 @@
+package ip
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+	"path/filepath"
+	"strings"
+	"sort"
+	"log"
+)
+
+// Image file found in source directory
+type ImageFile struct {
+	os.FileInfo
+	Path string // slash separated path relative to source directory
+}
+
+// Sort ImageFile by Path in natural order
+type Files []ImageFile
+
+func (files Files) Len() int {
+	return len(files)
+}
+
+func (files Files) Less(i, j int) bool {
+	return NaturalLess(files[i].Path, files[j].Path)
+}
+
+func (files Files) Swap(i, j int) {
+	files[i], files[j] = files[j], files[i]
+}
+
+func isImage(ext string) bool {
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".tif", ".tiff", ".bmp", ".webp":
+		return true
+	}
+	return false
+}
+
+func isArchive(ext string) bool {
+	return ext == ".cbz" || ext == ".zip"
+}
+
+func isPdf(ext string) bool {
+	return ext == ".pdf"
+}
+
+// Check if filename has supported image archive extension
+func IsArchiveFile(filename string) bool {
+	return isArchive(strings.ToLower(filepath.Ext(filename)))
+}
+
+// Check if filename has PDF extension
+func IsPdfFile(filename string) bool {
+	return isPdf(strings.ToLower(filepath.Ext(filename)))
+}
+
+// Check if filename has supported image, image archive or PDF extension
+func IsImageFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return isImage(ext) || isArchive(ext) || isPdf(ext)
+}
+
+// Check if filename is in dir
+func IsInDir(filename, dir string) bool {
+	rel, err := filepath.Rel(dir, filename)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator))
+}
+
+// Read all files in dir. Files in subdirectories are included if recursive is true.
+func readFiles(dir string, recursive bool) ([]ImageFile, error) {
+	var result []ImageFile
+
+	if !recursive {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				result = append(result, ImageFile{file, file.Name()})
+			}
+		}
+		return result, nil
+	}
+
+	err := filepath.Walk(dir, func(filename string, file os.FileInfo, err error) error {
+		if err != nil {
+			// Failed to read root directory
+			if filename == dir {
+				return err
+			}
+			log.Printf("Error : %v : %v\n", filename, err)
+			return nil
+		}
+		if file.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		result = append(result, ImageFile{file, filepath.ToSlash(relPath)})
+		return nil
+	})
+	return result, err
+}
+
+// List all image files sorted by path in natural order.
+// Images in subdirectories are listed if recursive is true.
+// If manifest is not empty, images in a folder having manifest file are sorted in order of the manifest.
+func ReadImages(dir string, recursive bool, manifest string) (Files, error) {
+	var result Files
+	files, err := readFiles(dir, recursive)
+	if err != nil {
+		return result, err
+	}
+
+	for _, file := range files {
+		if IsImageFile(file.Name()) {
+			result = append(result, file)
+		}
+	}
+
+	if manifest != "" {
+		sort.Sort(manifestFiles{result, readManifests(dir, result, manifest)})
+	} else {
+		sort.Sort(result)
+	}
+	return result, nil
+}
+
+// List image files that modified after timeAfterOptional.
+// Images in subdirectories are listed if recursive is true.
+func ListImages(dir string, recursive bool, manifest string, watchDelay int, lastCheckTime time.Time) (Files, time.Time, error) {
+	now := time.Now()
+
+	duration := -time.Duration(watchDelay) * time.Second
+	listAfter := lastCheckTime
+	if watchDelay > 0 && listAfter.After(time.Unix(0, 0)) {
+		listAfter = listAfter.Add(duration)
+	}
+	listBefore := now.Add(duration)
+
+	var result Files
+	files, err := ReadImages(dir, recursive, manifest)
+
+	// Failed to read directory
+	if err != nil {
+		return result, lastCheckTime, err
+	}
+
+	lastCheckTime = now
+
+	// Get file list that modified after EMT
+	for _, file := range files {
+		modTime := file.ModTime()
+		if !modTime.Before(listAfter) && !modTime.After(listBefore) {
+			result = append(result, file)
+		}
+	}
+
+	if result.Len() > 0 {
+		log.Printf("[+] %v\n", result.Len())
+	}
+
+	return result, lastCheckTime, nil
+}
@@ -0,0 +1,80 @@
+package ip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createTestFiles(t *testing.T, dir string, filenames ...string) {
+	modTime := time.Now().Add(-time.Minute)
+	for _, filename := range filenames {
+		path := filepath.Join(dir, filepath.FromSlash(filename))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte{}, 0666); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+}
+
+func testListImages(t *testing.T, recursive bool, expected []string) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	createTestFiles(t, dir, "b.jpg", "a.png", "note.txt", "vol1/01.jpg", "vol1/sub/02.gif", "vol2/01.jpeg")
+
+	files, _, err := ListImages(dir, recursive, "", 5, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != len(expected) {
+		t.Fatalf("file count mismatch. expected=%v, actual=%v", expected, files)
+	}
+	for i, file := range files {
+		if file.Path != expected[i] {
+			t.Errorf("path mismatch. expected=%v, actual=%v", expected[i], file.Path)
+		}
+	}
+}
+
+func TestListImages(t *testing.T) {
+	testListImages(t, false, []string{"a.png", "b.jpg"})
+}
+
+func TestListImagesRecursive(t *testing.T) {
+	testListImages(t, true, []string{"a.png", "b.jpg", "vol1/01.jpg", "vol1/sub/02.gif", "vol2/01.jpeg"})
+}
+
+func TestReadImagesNaturalOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	createTestFiles(t, dir, "page10.jpg", "page2.jpg", "Page1.jpg", "vol10/1.jpg", "vol2/1.jpg")
+
+	files, err := ReadImages(dir, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Page1.jpg", "page2.jpg", "page10.jpg", "vol2/1.jpg", "vol10/1.jpg"}
+	if len(files) != len(expected) {
+		t.Fatalf("file count mismatch. expected=%v, actual=%v", expected, files)
+	}
+	for i, file := range files {
+		if file.Path != expected[i] {
+			t.Errorf("path mismatch. expected=%v, actual=%v", expected[i], file.Path)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ip
+
+import (
+	"context"
+	"image"
+)
+
+
+// ----------------------------------------------------------------------------
+// Filter source
+// ----------------------------------------------------------------------------
+type FilterSource struct {
+	Image    image.Image
+	Filename string
+}
+
+func NewFilterSource(image image.Image, filename string) *FilterSource {
+	return &FilterSource{image, filename}
+}
+
+
+// ----------------------------------------------------------------------------
+// Filter result
+// ----------------------------------------------------------------------------
+type FilterResult interface {
+	Image() image.Image
+	Log()
+}
+
+// Implemented by results of filters rotating image
+type RotateResult interface {
+	RotatedAngle() float32
+}
+
+// Implemented by results of filters cropping image
+type CropResult interface {
+	CropRect() image.Rectangle
+}
+
+// Implemented by results of filters scaling image
+type ScaledResult interface {
+	Scale() float64 // ratio of result size to source size
+}
+
+// Part of split image
+type ImagePart struct {
+	Image image.Image
+	Side  string  // side of split page. L or R. empty if image is not split
+	Scale float64 // ratio of image size to loaded page. set by pipeline
+}
+
+// Implemented by results of filters splitting image into multiple images.
+// Each part is passed to next filters separately. Image is not split if Parts() is empty.
+type SplitResult interface {
+	Parts() []ImagePart
+}
+
+// ----------------------------------------------------------------------------
+// Filter interface
+// ----------------------------------------------------------------------------
+type Filter interface {
+	// Run filter. Long running filters should return ctx.Err() when ctx is done.
+	Run(ctx context.Context, src *FilterSource) (FilterResult, error)
+}
+
+// ----------------------------------------------------------------------------
+// Filter error
+// ----------------------------------------------------------------------------
+type FilterError struct {
+	Filter string // filter name
+	Err    error
+}
+
+func (e *FilterError) Error() string {
+	return e.Filter + " : " + e.Err.Error()
+}
+
+func (e *FilterError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,172 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"github.com/mitchellh/mapstructure"
+	"image"
+	"log"
+)
+
+// grayscale modes
+const (
+	GrayscaleAlways = "always" // convert all images
+	GrayscaleAuto   = "auto"   // convert images without meaningful color
+)
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+type GrayscaleOption struct {
+	Mode           string  // always, auto. default: always
+	Red            float32 // channel weights. default: 0.299, 0.587, 0.114 (ITU-R BT.601)
+	Green          float32
+	Blue           float32
+	ColorThreshold uint8   // auto : min difference of channels of color dot (0~255). default: 32
+	ColorRate      float32 // auto : min rate of color dots to keep color (0 <= rate < 1.0). default: 0.005
+}
+
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "grayscale",
+		Option: GrayscaleOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewGrayscaleOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewGrayscaleFilter(*option.(*GrayscaleOption))
+		},
+	})
+}
+
+func NewGrayscaleOption(m map[string]interface{}) (*GrayscaleOption, error) {
+	option := GrayscaleOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	switch option.Mode {
+	case "", GrayscaleAlways, GrayscaleAuto:
+	default:
+		return nil, errors.New("Unknown grayscale mode : " + option.Mode)
+	}
+	if option.Red < 0 || option.Green < 0 || option.Blue < 0 {
+		return nil, errors.New("Grayscale weights should not be negative")
+	}
+	if option.ColorRate < 0 || option.ColorRate >= 1 {
+		return nil, errors.New("colorRate should be 0 <= rate < 1.0")
+	}
+
+	return &option, nil
+}
+
+type GrayscaleResult struct {
+	image     image.Image
+	filename  string
+	converted bool
+	colorRate float32 // rate of color dots. auto mode only
+}
+
+func (r GrayscaleResult) Image() image.Image {
+	return r.image
+}
+
+func (r GrayscaleResult) Log() {
+	if !r.converted {
+		log.Printf("[COLOR] %v : %.3f\n", r.filename, r.colorRate)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// GrayscaleFilter converts image to single-channel *image.Gray.
+// In auto mode, images with meaningful color are kept.
+type GrayscaleFilter struct {
+	option GrayscaleOption
+}
+
+// Create GrayscaleFilter instance
+func NewGrayscaleFilter(option GrayscaleOption) *GrayscaleFilter {
+	if option.Red == 0 && option.Green == 0 && option.Blue == 0 {
+		option.Red, option.Green, option.Blue = 0.299, 0.587, 0.114
+	}
+	if option.ColorThreshold == 0 {
+		option.ColorThreshold = 32
+	}
+	if option.ColorRate == 0 {
+		option.ColorRate = 0.005
+	}
+	return &GrayscaleFilter{option}
+}
+
+// Implements Filter.Run()
+func (f GrayscaleFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	src := s.Image
+	if _, ok := src.(*image.Gray); ok {
+		return GrayscaleResult{src, s.Filename, true, 0}, nil
+	}
+
+	colorRate := float32(0)
+	if f.option.Mode == GrayscaleAuto {
+		colorRate = f.calcColorRate(src)
+		if colorRate >= f.option.ColorRate {
+			return GrayscaleResult{src, s.Filename, false, colorRate}, nil
+		}
+	}
+	return GrayscaleResult{f.toGray(src), s.Filename, true, colorRate}, nil
+}
+
+// Rate of dots with difference of channels larger than threshold
+func (f GrayscaleFilter) calcColorRate(img image.Image) float32 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	threshold := uint32(f.option.ColorThreshold) * 256
+	dotCount := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			max, min := r, r
+			for _, c := range []uint32{g, b} {
+				if c > max {
+					max = c
+				}
+				if c < min {
+					min = c
+				}
+			}
+			if max - min > threshold {
+				dotCount++
+			}
+		}
+	}
+	return float32(dotCount) / float32(width * height)
+}
+
+// Convert to gray with channel weights
+func (f GrayscaleFilter) toGray(src image.Image) *image.Gray {
+	o := f.option
+	sum := o.Red + o.Green + o.Blue
+	wr, wg, wb := o.Red / sum, o.Green / sum, o.Blue / sum
+
+	bounds := src.Bounds()
+	dest := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		i := y * dest.Stride
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b, _ := src.At(bounds.Min.X + x, bounds.Min.Y + y).RGBA()
+			lum := (wr * float32(r) + wg * float32(g) + wb * float32(b)) / 257
+			dest.Pix[i + x] = uint8(Minf32(255, lum + 0.5))
+		}
+	}
+	return dest
+}
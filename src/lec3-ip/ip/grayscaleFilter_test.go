@@ -0,0 +1,64 @@
+package ip
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func runGrayscale(t *testing.T, img image.Image, option GrayscaleOption) image.Image {
+	result, err := NewGrayscaleFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	return result.Image()
+}
+
+func TestGrayscaleWeights(t *testing.T) {
+	img := CreateImage(10, 10, color.RGBA{200, 100, 0, 255})
+
+	gray, ok := runGrayscale(t, img, GrayscaleOption{}).(*image.Gray)
+	if !ok {
+		t.Fatal("result is not *image.Gray")
+	}
+	// 0.299 * 200 + 0.587 * 100
+	if v := gray.GrayAt(5, 5).Y; v != 119 {
+		t.Errorf("default weights mismatch : %v", v)
+	}
+
+	gray = runGrayscale(t, img, GrayscaleOption{Red: 1}).(*image.Gray)
+	if v := gray.GrayAt(5, 5).Y; v != 200 {
+		t.Errorf("red weight mismatch : %v", v)
+	}
+}
+
+func TestGrayscaleAuto(t *testing.T) {
+	// black and white page with slight color noise is converted
+	page := CreateImage(100, 100, color.RGBA{250, 245, 240, 255})
+	FillRect(page, 10, 10, 90, 90, color.Black)
+	if _, ok := runGrayscale(t, page, GrayscaleOption{Mode: GrayscaleAuto}).(*image.Gray); !ok {
+		t.Error("black and white page is not converted")
+	}
+
+	// color insert is kept
+	FillRect(page, 10, 10, 30, 30, color.RGBA{200, 30, 30, 255})
+	if _, ok := runGrayscale(t, page, GrayscaleOption{Mode: GrayscaleAuto}).(*image.Gray); ok {
+		t.Error("color page is converted")
+	}
+	if _, ok := runGrayscale(t, page, GrayscaleOption{}).(*image.Gray); !ok {
+		t.Error("color page is not converted in always mode")
+	}
+}
+
+func TestGrayscaleOption(t *testing.T) {
+	for _, m := range []map[string]interface{}{
+		{"mode": "sometimes"},
+		{"red": -1},
+		{"colorRate": 1.5},
+	} {
+		if _, err := NewGrayscaleOption(m); err == nil {
+			t.Errorf("expected option error : %v", m)
+		}
+	}
+}
@@ -1,8 +1,11 @@
-package main
+package ip
 
 import (
 	"errors"
 	"github.com/disintegration/gift"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
 	"image"
 	"image/color"
 	"image/gif"
@@ -20,8 +23,22 @@ func getExt(filename string) string {
 	return strings.ToLower(filepath.Ext(filename))
 }
 
-// Load Image
+// Load Image. First page is loaded from multi-page TIFF file.
 func LoadImage(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	} else {
+		defer func() {
+			file.Close()
+		}()
+	}
+
+	return DecodeImage(file, filename)
+}
+
+// Decode image in format of filename extension
+func DecodeImage(r io.Reader, filename string) (image.Image, error) {
 	var decoder func(io.Reader) (image.Image, error) = nil
 
 	ext := getExt(filename)
@@ -32,22 +49,19 @@ func LoadImage(filename string) (image.Image, error) {
 		decoder = gif.Decode
 	case ".png":
 		decoder = png.Decode
+	case ".tif", ".tiff":
+		decoder = tiff.Decode
+	case ".bmp":
+		decoder = bmp.Decode
+	case ".webp":
+		decoder = webp.Decode
 	}
 
 	if decoder == nil {
 		return nil, errors.New("Unsupported file format : " + ext)
 	}
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	} else {
-		defer func() {
-			file.Close()
-		}()
-	}
-
-	img, err := decoder(file)
+	img, err := decoder(r)
 	if err != nil {
 		return nil, err
 	}
@@ -62,16 +76,9 @@ func SaveJpeg(img image.Image, dir string, filename string, quality int) error {
 		return err
 	}
 
-	file, err := os.Create(path.Join(dir, filename))
-	if err != nil {
-		return err
-	} else {
-		defer func() {
-			file.Close()
-		}()
-	}
-
-	return jpeg.Encode(file, img, &jpeg.Options{quality})
+	return WriteFileAtomic(path.Join(dir, filename), func(w io.Writer) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	})
 }
 
 // create image
@@ -231,3 +238,16 @@ func GetCropRect(left, top, right, bottom int, bounds image.Rectangle, maxWidthC
 
 	return image.Rect(left, top, right, bottom)
 }
+
+// Run gift filters on image. Grayscale image is kept grayscale.
+func applyGift(g *gift.GIFT, src image.Image) image.Image {
+	bounds := g.Bounds(src.Bounds())
+	if _, ok := src.(*image.Gray); ok {
+		dest := image.NewGray(bounds)
+		g.Draw(dest, src)
+		return dest
+	}
+	dest := image.NewRGBA(bounds)
+	g.Draw(dest, src)
+	return dest
+}
@@ -0,0 +1,219 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"github.com/mitchellh/mapstructure"
+	"image"
+	"image/color"
+	"log"
+	"math"
+)
+
+// levels modes
+const (
+	LevelsLuminance = "luminance" // stretch all channels by range of luminance
+	LevelsChannel   = "channel"   // stretch each channel by its own range
+)
+
+// gamma of e-ink curve. darkens mid tones washed out on e-ink screen
+const EInkGamma = 0.6
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+type LevelsOption struct {
+	Mode          string  // luminance, channel. default: luminance
+	DarkClipRate  float32 // rate of darkest dots clipped to black (0 <= rate < 0.5)
+	LightClipRate float32 // rate of lightest dots clipped to white (0 <= rate < 0.5)
+	Gamma         float32 // gamma after stretch. less than 1 darkens, greater than 1 lightens. 0 or 1 keeps image
+	EInk          bool    // apply e-ink gamma curve when gamma is not set
+}
+
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "levels",
+		Option: LevelsOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewLevelsOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewLevelsFilter(*option.(*LevelsOption))
+		},
+	})
+}
+
+func NewLevelsOption(m map[string]interface{}) (*LevelsOption, error) {
+	option := LevelsOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	switch option.Mode {
+	case "", LevelsLuminance, LevelsChannel:
+	default:
+		return nil, errors.New("Unknown levels mode : " + option.Mode)
+	}
+	if option.DarkClipRate < 0 || option.DarkClipRate >= 0.5 ||
+		option.LightClipRate < 0 || option.LightClipRate >= 0.5 {
+		return nil, errors.New("clip rate should be 0 <= rate < 0.5")
+	}
+	if option.Gamma < 0 {
+		return nil, errors.New("Gamma should not be negative")
+	}
+
+	return &option, nil
+}
+
+type LevelsResult struct {
+	image    image.Image
+	filename string
+	ranges   [][2]int // stretched range of luminance, or of each channel
+}
+
+func (r LevelsResult) Image() image.Image {
+	return r.image
+}
+
+func (r LevelsResult) Log() {
+	log.Printf("[LEVELS] %v : %v\n", r.filename, r.ranges)
+}
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// LevelsFilter stretches contrast by histogram.
+// Darkest and lightest dots of clip rates are clipped, and the rest are stretched to 0 ~ 255.
+type LevelsFilter struct {
+	option LevelsOption
+}
+
+// Create LevelsFilter instance
+func NewLevelsFilter(option LevelsOption) *LevelsFilter {
+	if option.Gamma == 0 && option.EInk {
+		option.Gamma = EInkGamma
+	}
+	return &LevelsFilter{option}
+}
+
+// Implements Filter.Run()
+func (f LevelsFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	src := s.Image
+	if gray, ok := src.(*image.Gray); ok {
+		low, high := f.calcRange(calcGrayHistogram(gray))
+		return LevelsResult{f.applyGray(gray, f.createTable(low, high)), s.Filename, [][2]int{{low, high}}}, nil
+	}
+
+	histograms := calcHistograms(src)
+	var tables [3][256]uint8
+	var ranges [][2]int
+	if f.option.Mode == LevelsChannel {
+		for c := 0; c < 3; c++ {
+			low, high := f.calcRange(histograms[c])
+			tables[c] = f.createTable(low, high)
+			ranges = append(ranges, [2]int{low, high})
+		}
+	} else {
+		low, high := f.calcRange(histograms[3])
+		table := f.createTable(low, high)
+		tables = [3][256]uint8{table, table, table}
+		ranges = append(ranges, [2]int{low, high})
+	}
+	return LevelsResult{f.apply(src, tables), s.Filename, ranges}, nil
+}
+
+// Range of histogram after clipping darkest and lightest dots
+func (f LevelsFilter) calcRange(histogram [256]int) (int, int) {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+
+	low, high := 0, 255
+	darkCount := int(float32(total) * f.option.DarkClipRate)
+	for sum := 0; low < 255; low++ {
+		if sum += histogram[low]; sum > darkCount {
+			break
+		}
+	}
+	lightCount := int(float32(total) * f.option.LightClipRate)
+	for sum := 0; high > 0; high-- {
+		if sum += histogram[high]; sum > lightCount {
+			break
+		}
+	}
+	return low, high
+}
+
+// Lookup table mapping low ~ high to 0 ~ 255 with gamma
+func (f LevelsFilter) createTable(low, high int) [256]uint8 {
+	var table [256]uint8
+	gamma := float64(f.option.Gamma)
+	for v := 0; v < 256; v++ {
+		x := float64(v) / 255
+		if high > low {
+			x = math.Min(1, math.Max(0, float64(v - low) / float64(high - low)))
+		}
+		if gamma > 0 && gamma != 1 {
+			x = math.Pow(x, 1 / gamma)
+		}
+		table[v] = uint8(x * 255 + 0.5)
+	}
+	return table
+}
+
+func (f LevelsFilter) applyGray(src *image.Gray, table [256]uint8) *image.Gray {
+	bounds := src.Bounds()
+	dest := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			dest.Pix[y * dest.Stride + x] = table[src.GrayAt(bounds.Min.X + x, bounds.Min.Y + y).Y]
+		}
+	}
+	return dest
+}
+
+func (f LevelsFilter) apply(src image.Image, tables [3][256]uint8) *image.RGBA {
+	bounds := src.Bounds()
+	dest := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.NRGBAModel.Convert(src.At(bounds.Min.X + x, bounds.Min.Y + y)).(color.NRGBA)
+			dest.Set(x, y, color.NRGBA{tables[0][c.R], tables[1][c.G], tables[2][c.B], c.A})
+		}
+	}
+	return dest
+}
+
+// Histogram of gray image
+func calcGrayHistogram(img *image.Gray) [256]int {
+	var histogram [256]int
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			histogram[img.GrayAt(x, y).Y]++
+		}
+	}
+	return histogram
+}
+
+// Histograms of red, green, blue and luminance
+func calcHistograms(img image.Image) [4][256]int {
+	var histograms [4][256]int
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			histograms[0][c.R]++
+			histograms[1][c.G]++
+			histograms[2][c.B]++
+			histograms[3][color.GrayModel.Convert(c).(color.Gray).Y]++
+		}
+	}
+	return histograms
+}
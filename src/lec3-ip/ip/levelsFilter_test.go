@@ -0,0 +1,92 @@
+package ip
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func runLevels(t *testing.T, img image.Image, option LevelsOption) LevelsResult {
+	result, err := NewLevelsFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	return result.(LevelsResult)
+}
+
+// washed out page of gray 60 ~ 200 with a few dots of 0 and 255
+func createWashedOutImage() *image.RGBA {
+	img := CreateImage(100, 100, color.Gray{200})
+	FillRect(img, 10, 10, 50, 90, color.Gray{60})
+	img.Set(0, 0, color.Black)
+	img.Set(99, 99, color.White)
+	return img
+}
+
+func TestLevelsLuminance(t *testing.T) {
+	img := createWashedOutImage()
+
+	// without clipping, range is kept by dots of 0 and 255
+	result := runLevels(t, img, LevelsOption{})
+	if r := result.ranges[0]; r != [2]int{0, 255} {
+		t.Errorf("range mismatch : %v", r)
+	}
+
+	result = runLevels(t, img, LevelsOption{DarkClipRate: 0.01, LightClipRate: 0.01})
+	if r := result.ranges[0]; r != [2]int{60, 200} {
+		t.Errorf("clipped range mismatch : %v", r)
+	}
+	if r, _, _, _ := result.Image().At(20, 20).RGBA(); r != 0 {
+		t.Errorf("dark is not stretched to black : %v", r >> 8)
+	}
+	if r, _, _, _ := result.Image().At(80, 80).RGBA(); r != 0xffff {
+		t.Errorf("light is not stretched to white : %v", r >> 8)
+	}
+}
+
+func TestLevelsChannel(t *testing.T) {
+	img := CreateImage(10, 10, color.RGBA{100, 50, 200, 255})
+	FillRect(img, 0, 0, 10, 5, color.RGBA{200, 150, 220, 255})
+
+	result := runLevels(t, img, LevelsOption{Mode: LevelsChannel})
+	if len(result.ranges) != 3 || result.ranges[0] != [2]int{100, 200} || result.ranges[2] != [2]int{200, 220} {
+		t.Fatalf("channel ranges mismatch : %v", result.ranges)
+	}
+	if c := result.Image().At(5, 8).(color.RGBA); c.R != 0 || c.G != 0 || c.B != 0 {
+		t.Errorf("channels are not stretched : %v", c)
+	}
+}
+
+func TestLevelsGray(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(100 + i)
+	}
+
+	result := runLevels(t, img, LevelsOption{EInk: true})
+	gray, ok := result.Image().(*image.Gray)
+	if !ok {
+		t.Fatal("result is not *image.Gray")
+	}
+	if gray.Pix[0] != 0 || gray.Pix[99] != 255 {
+		t.Errorf("gray is not stretched : %v ~ %v", gray.Pix[0], gray.Pix[99])
+	}
+	// e-ink gamma darkens mid tone
+	if v := gray.Pix[50]; v >= 128 {
+		t.Errorf("mid tone is not darkened : %v", v)
+	}
+}
+
+func TestLevelsOption(t *testing.T) {
+	for _, m := range []map[string]interface{}{
+		{"mode": "auto"},
+		{"darkClipRate": 0.5},
+		{"lightClipRate": -0.1},
+		{"gamma": -1},
+	} {
+		if _, err := NewLevelsOption(m); err == nil {
+			t.Errorf("expected option error : %v", m)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ip
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ----------------------------------------------------------------------------
+// Manifest
+// ----------------------------------------------------------------------------
+
+// Read file names in manifest file. Each line is a file name relative to the folder of the manifest.
+// Empty lines and lines starting with '#' are ignored.
+func ReadManifest(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// UTF-8 BOM written by some editors
+		line = strings.TrimPrefix(line, "\ufeff")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, path.Clean(filepath.ToSlash(line)))
+	}
+	return names, scanner.Err()
+}
+
+// Read manifest files in folders of files. Returns rank of each listed path.
+func readManifests(dir string, files Files, manifest string) map[string]int {
+	ranks := make(map[string]int)
+	visited := make(map[string]bool)
+
+	for _, file := range files {
+		folder := path.Dir(file.Path)
+		if visited[folder] {
+			continue
+		}
+		visited[folder] = true
+
+		names, err := ReadManifest(filepath.Join(dir, filepath.FromSlash(folder), manifest))
+		if err != nil {
+			continue
+		}
+		for i, name := range names {
+			p := path.Join(folder, name)
+			// first entry is used if a file is listed twice
+			if _, ok := ranks[p]; !ok {
+				ranks[p] = i
+			}
+		}
+	}
+	return ranks
+}
+
+// Sort files in a folder in order of manifest. Files not in manifest follow in natural order.
+// Folders are sorted in natural order.
+type manifestFiles struct {
+	Files
+	ranks map[string]int // order of path in manifest
+}
+
+func (f manifestFiles) Less(i, j int) bool {
+	a, b := f.Files[i].Path, f.Files[j].Path
+	if path.Dir(a) == path.Dir(b) {
+		rankA, okA := f.ranks[a]
+		rankB, okB := f.ranks[b]
+		if okA && okB {
+			return rankA < rankB
+		}
+		if okA != okB {
+			return okA
+		}
+	}
+	return NaturalLess(a, b)
+}
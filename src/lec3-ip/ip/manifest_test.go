@@ -0,0 +1,41 @@
+package ip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadImagesManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	createTestFiles(t, dir, "a.jpg", "b.jpg", "c.jpg", "d.jpg", "vol1/1.jpg", "vol1/2.jpg")
+	manifest := "# cover first\ncover.jpg\n\nc.jpg\n  a.jpg  \nc.jpg\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "order.txt"), []byte(manifest), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "vol1", "order.txt"), []byte("2.jpg\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ReadImages(dir, true, "order.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// missing file in manifest is ignored, and files not in manifest follow in natural order
+	expected := []string{"c.jpg", "a.jpg", "b.jpg", "d.jpg", "vol1/2.jpg", "vol1/1.jpg"}
+	if len(files) != len(expected) {
+		t.Fatalf("file count mismatch. expected=%v, actual=%v", expected, files)
+	}
+	for i, file := range files {
+		if file.Path != expected[i] {
+			t.Errorf("path mismatch. expected=%v, actual=%v", expected[i], file.Path)
+		}
+	}
+}
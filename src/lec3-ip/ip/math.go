@@ -1,4 +1,4 @@
-package main
+package ip
 import "math"
 
 func Max(x, y int) int {
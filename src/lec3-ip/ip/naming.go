@@ -0,0 +1,263 @@
+package ip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ----------------------------------------------------------------------------
+// Name template
+// ----------------------------------------------------------------------------
+
+// Values of placeholders in output name template
+type NameFields struct {
+	Name   string // source name without extension. ex) page1, scan_002
+	Index  int    // page number in numbering group starting from 1. failed pages keep their index
+	Seq    int    // sequence number of written pages starting from 1. no gap
+	Folder string // slash separated output folder of source. ex) vol1, vol2/book/ch1
+	Side   string // side of split page. L or R. empty if page is not split
+	Page   int    // page number in multi-page file starting from 1
+	Ext    string // output file extension without dot. ex) jpg
+}
+
+// Name fields of page. folder is output folder of the page, and index is page index in numbering group starting from 0.
+func NewNameFields(page ImagePage, folder string, index int, format ImageFormat) NameFields {
+	name := page.Name()
+	return NameFields{
+		Name:   strings.TrimSuffix(name, path.Ext(name)),
+		Index:  index + 1,
+		Seq:    index + 1,
+		Folder: folder,
+		Page:   page.Index + 1,
+		Ext:    strings.TrimPrefix(format.Ext(), "."),
+	}
+}
+
+type nameTemplatePart struct {
+	text  string // literal text. empty if part is a placeholder
+	field string // placeholder name
+	width int    // zero padded width of number
+}
+
+// NameTemplate builds output path of page from placeholders.
+// ex) {folder}/{seq:04}.{ext}, {name}_{side}.{ext}
+//
+// Placeholders : {name}, {index}, {seq}, {folder}, {side}, {page}, {ext}
+// Numbers are padded with zeros to width. ex) {seq:04}
+// Output extension is added if template does not have {ext}.
+type NameTemplate struct {
+	template string
+	parts    []nameTemplatePart
+}
+
+func ParseNameTemplate(s string) (*NameTemplate, error) {
+	t := &NameTemplate{template: s}
+
+	rest := s
+	for rest != "" {
+		start := strings.IndexAny(rest, "{}")
+		if start < 0 {
+			t.parts = append(t.parts, nameTemplatePart{text: rest})
+			break
+		}
+		if rest[start] == '}' {
+			return nil, errors.New("Unmatched '}' in name template : " + s)
+		}
+		if start > 0 {
+			t.parts = append(t.parts, nameTemplatePart{text: rest[:start]})
+		}
+
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, errors.New("Unmatched '{' in name template : " + s)
+		}
+		part, err := parseNamePlaceholder(rest[start + 1:start + end])
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[start + end + 1:]
+	}
+
+	if len(t.parts) == 0 {
+		return nil, errors.New("Empty name template")
+	}
+	for _, part := range t.parts {
+		for _, dir := range strings.Split(filepath.ToSlash(part.text), "/") {
+			if dir == ".." {
+				return nil, errors.New("Name template should not have '..' : " + s)
+			}
+		}
+	}
+	if strings.HasPrefix(t.parts[0].text, "/") || filepath.IsAbs(t.parts[0].text) {
+		return nil, errors.New("Name template should be a relative path : " + s)
+	}
+	return t, nil
+}
+
+func parseNamePlaceholder(s string) (nameTemplatePart, error) {
+	field, format := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		field, format = s[:i], s[i + 1:]
+	}
+
+	part := nameTemplatePart{field: field}
+	switch field {
+	case "index", "seq", "page":
+		if format != "" {
+			width, err := strconv.Atoi(format)
+			if err != nil || width < 0 || width > 20 {
+				return part, errors.New("Invalid width of name template : " + s)
+			}
+			part.width = width
+		}
+	case "name", "folder", "side", "ext":
+		if format != "" {
+			return part, errors.New("Width is not supported : " + s)
+		}
+	default:
+		return part, errors.New("Unknown name template placeholder : " + field)
+	}
+	return part, nil
+}
+
+func (t *NameTemplate) String() string {
+	return t.template
+}
+
+// Check if template has placeholder of field
+func (t *NameTemplate) Uses(field string) bool {
+	for _, part := range t.parts {
+		if part.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Slash separated output path of page relative to dest directory
+func (t *NameTemplate) Format(fields NameFields) string {
+	var buf []string
+	for _, part := range t.parts {
+		var value string
+		switch part.field {
+		case "":
+			value = part.text
+		case "name":
+			value = fields.Name
+		case "index":
+			value = fmt.Sprintf("%0*d", part.width, fields.Index)
+		case "seq":
+			value = fmt.Sprintf("%0*d", part.width, fields.Seq)
+		case "folder":
+			value = fields.Folder
+		case "side":
+			value = fields.Side
+		case "page":
+			value = fmt.Sprintf("%0*d", part.width, fields.Page)
+		case "ext":
+			value = fields.Ext
+		}
+		buf = append(buf, value)
+	}
+
+	// cleaned as rooted path not to escape dest directory
+	name := strings.TrimPrefix(path.Clean("/" + strings.Join(buf, "")), "/")
+	if !t.Uses("ext") {
+		name += "." + fields.Ext
+	}
+	// sides of split page are not overwritten by each other
+	if !t.Uses("side") && !t.Uses("seq") {
+		name = SideName(name, fields.Side)
+	}
+	return name
+}
+
+// Name of split image. Side is added to name before extension. ex) page1_L.jpg
+// name is returned as is if side is empty.
+func SideName(name string, side string) string {
+	if side == "" {
+		return name
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + side + ext
+}
+
+// ----------------------------------------------------------------------------
+// Sequence writer
+// ----------------------------------------------------------------------------
+
+// SequenceWriter writes pages to image files in dir named by template.
+// Pages are numbered in written order, so sequence numbers have no gap even if some pages are dropped.
+type SequenceWriter struct {
+	dir       string
+	template  *NameTemplate
+	overwrite OverwritePolicy
+	seq       int // number of written pages
+}
+
+func NewSequenceWriter(dir string, template *NameTemplate, overwrite OverwritePolicy) *SequenceWriter {
+	return &SequenceWriter{dir: dir, template: template, overwrite: overwrite}
+}
+
+// Continue numbering after seq pages written before. ex) pages written in previous run
+func (w *SequenceWriter) SetSeq(seq int) *SequenceWriter {
+	w.seq = seq
+	return w
+}
+
+// Number of written pages
+func (w *SequenceWriter) Seq() int {
+	return w.seq
+}
+
+// Write page to image file. Returns written filename, or existing filename and true if page is skipped.
+func (w *SequenceWriter) WriteFile(page *BookPage) (string, bool, error) {
+	fields := page.Fields
+	fields.Seq = w.seq + 1
+	filename := filepath.Join(w.dir, filepath.FromSlash(w.template.Format(fields)))
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return "", false, err
+	}
+
+	// skipped page keeps its sequence number
+	w.seq++
+	destFilename, err := writeFileAs(filename, w.overwrite, func(out io.Writer) error {
+		_, err := out.Write(page.Data)
+		return err
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if destFilename == "" {
+		log.Printf("[SKIP] %v : dest file exists\n", filename)
+		return filename, true, nil
+	}
+	return destFilename, false, nil
+}
+
+// Implements BookWriter.WritePage(). page.OnWrite is called with written filename.
+func (w *SequenceWriter) WritePage(page *BookPage) error {
+	filename, skipped, err := w.WriteFile(page)
+	if page.OnWrite != nil {
+		page.OnWrite(filename, skipped, err)
+	}
+	return err
+}
+
+// Nothing to finish. Pages are already written.
+func (w *SequenceWriter) Close() error {
+	return nil
+}
+
+// Written pages are kept
+func (w *SequenceWriter) Abort() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package ip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameTemplate(t *testing.T) {
+	fields := NameFields{Name: "page1", Index: 3, Seq: 2, Folder: "vol1", Side: "L", Page: 1, Ext: "jpg"}
+
+	tests := map[string]string{
+		"{folder}/{seq:04}.{ext}": "vol1/0002.jpg",
+		"{name}_{side}.{ext}":     "page1_L.jpg",
+		"{index:3}_{page}":        "003_1_L.jpg", // side is added not to overwrite other side
+		"out/{name}":              "out/page1_L.jpg",
+	}
+	for template, expected := range tests {
+		name, err := ParseNameTemplate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := name.Format(fields); actual != expected {
+			t.Errorf("name mismatch. template=%v, expected=%v, actual=%v", template, expected, actual)
+		}
+	}
+
+	// root folder is removed, and field values do not escape dest directory
+	name, _ := ParseNameTemplate("{folder}/{seq:02}.{ext}")
+	fields.Folder = "."
+	if actual := name.Format(fields); actual != "02.jpg" {
+		t.Errorf("root folder name = %v", actual)
+	}
+	fields.Folder = "../.."
+	if actual := name.Format(fields); actual != "02.jpg" {
+		t.Errorf("escaped name = %v", actual)
+	}
+	if !name.Uses("seq") || name.Uses("side") {
+		t.Error("placeholder check mismatch")
+	}
+
+	for _, invalid := range []string{"", "{unknown}", "{seq", "seq}", "{name:04}", "{seq:x}", "../{name}", "/out/{name}"} {
+		if _, err := ParseNameTemplate(invalid); err == nil {
+			t.Errorf("invalid template is accepted : %v", invalid)
+		}
+	}
+}
+
+func TestSequenceWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name, err := ParseNameTemplate("{folder}/{seq:03}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewOrderedSink(func(group string) (BookWriter, error) {
+		return NewSequenceWriter(dir, name, OverwriteExisting), nil
+	})
+
+	page := func(data string) *BookPage {
+		return &BookPage{Data: []byte(data), Fields: NameFields{Folder: "vol1", Ext: "jpg"}}
+	}
+
+	// dropped page does not leave a gap
+	sink.Add("vol1", 2, page("c"))
+	sink.Add("vol1", 1, nil)
+	sink.Add("vol1", 0, page("a"))
+	if err := sink.SetCount("vol1", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	for filename, expected := range map[string]string{"001.jpg": "a", "002.jpg": "c"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "vol1", filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%v = %v", filename, string(data))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vol1", "003.jpg")); err == nil {
+		t.Error("sequence has a gap")
+	}
+}
+
+func TestSequenceWriterFilename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name, err := ParseNameTemplate("{seq:03}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "001.jpg"), []byte("x"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "002.jpg"), []byte("x"), 0666)
+
+	for _, c := range []struct {
+		policy   OverwritePolicy
+		seq      int
+		expected string
+		skipped  bool
+	}{
+		{SkipExisting, 0, "001.jpg", true},
+		{VersionExisting, 1, "002_1.jpg", false},
+		{OverwriteExisting, 2, "003.jpg", false},
+	} {
+		var filename string
+		var skipped bool
+		page := &BookPage{Data: []byte("a"), Fields: NameFields{Ext: "jpg"}}
+		page.OnWrite = func(f string, s bool, err error) {
+			filename, skipped = f, s
+		}
+		if err := NewSequenceWriter(dir, name, c.policy).SetSeq(c.seq).WritePage(page); err != nil {
+			t.Fatal(err)
+		}
+		if filename != filepath.Join(dir, c.expected) || skipped != c.skipped {
+			t.Errorf("written filename mismatch. expected=%v %v, actual=%v %v", c.expected, c.skipped, filename, skipped)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ip
+
+import (
+	"sort"
+	"strings"
+)
+
+// ----------------------------------------------------------------------------
+// Natural sort
+// ----------------------------------------------------------------------------
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// Compare digit runs by numeric value. Leading zeros are ignored.
+func compareNumbers(a, b string) int {
+	ta, tb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(ta) != len(tb) {
+		if len(ta) < len(tb) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(ta, tb)
+}
+
+// Compare single path component in natural order
+func compareNatural(a, b string) int {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	i, j := 0, 0
+	for i < len(la) && j < len(lb) {
+		if isDigit(la[i]) && isDigit(lb[j]) {
+			si, sj := i, j
+			for i < len(la) && isDigit(la[i]) {
+				i++
+			}
+			for j < len(lb) && isDigit(lb[j]) {
+				j++
+			}
+			if c := compareNumbers(la[si:i], lb[sj:j]); c != 0 {
+				return c
+			}
+			continue
+		}
+
+		if la[i] != lb[j] {
+			if la[i] < lb[j] {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+
+	if c := (len(la) - i) - (len(lb) - j); c != 0 {
+		return c
+	}
+	// equal in natural order. ex) "01" and "1", "A" and "a"
+	return strings.Compare(a, b)
+}
+
+// Sort slash separated paths in natural order
+type naturalStrings []string
+
+func (s naturalStrings) Len() int {
+	return len(s)
+}
+
+func (s naturalStrings) Less(i, j int) bool {
+	return NaturalLess(s[i], s[j])
+}
+
+func (s naturalStrings) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Check if slash separated path a comes before b in natural order.
+// Numbers are compared by value and letters are compared case-insensitively.
+// ex) page2.jpg < page10.jpg, vol1/page10.jpg < vol2/page1.jpg
+func NaturalLess(a, b string) bool {
+	pa, pb := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		// files in a directory come before its subdirectories
+		lastA, lastB := i == len(pa) - 1, i == len(pb) - 1
+		if lastA != lastB {
+			return lastA
+		}
+		if c := compareNatural(pa[i], pb[i]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// Sort slash separated paths in natural order
+func SortNatural(paths []string) {
+	sort.Sort(naturalStrings(paths))
+}
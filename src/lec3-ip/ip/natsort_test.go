@@ -0,0 +1,41 @@
+package ip
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"page2.jpg", "page10.jpg"},
+		{"page02.jpg", "page3.jpg"},
+		{"Page1.jpg", "page2.jpg"},
+		{"a.jpg", "B.jpg"},
+		{"vol1/page10.jpg", "vol2/page1.jpg"},
+		{"vol2/page1.jpg", "vol10/page1.jpg"},
+		{"cover.jpg", "ch1/001.jpg"},
+		{"page1.jpg", "page1a.jpg"},
+	}
+	for _, test := range tests {
+		if !NaturalLess(test.a, test.b) {
+			t.Errorf("expected %v < %v", test.a, test.b)
+		}
+		if NaturalLess(test.b, test.a) {
+			t.Errorf("expected not %v < %v", test.b, test.a)
+		}
+	}
+}
+
+func TestNaturalSort(t *testing.T) {
+	entries := []string{"10.jpg", "9.jpg", "1.jpg", "010a.jpg", "100.jpg"}
+	sort.Sort(naturalStrings(entries))
+
+	expected := []string{"1.jpg", "9.jpg", "10.jpg", "010a.jpg", "100.jpg"}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Fatalf("order mismatch. expected=%v, actual=%v", expected, entries)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package ip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ----------------------------------------------------------------------------
+// Overwrite policy
+// ----------------------------------------------------------------------------
+
+// How to handle existing dest file
+type OverwritePolicy int
+
+const (
+	OverwriteExisting OverwritePolicy = iota // replace existing file
+	SkipExisting                             // keep existing file and do not write
+	VersionExisting                          // write to new name with version number. ex) page1_1.jpg
+)
+
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	switch strings.ToLower(s) {
+	case "overwrite", "":
+		return OverwriteExisting, nil
+	case "skip":
+		return SkipExisting, nil
+	case "version":
+		return VersionExisting, nil
+	}
+	return OverwriteExisting, errors.New("Unknown overwrite policy : " + s)
+}
+
+func (p OverwritePolicy) String() string {
+	switch p {
+	case SkipExisting:
+		return "skip"
+	case VersionExisting:
+		return "version"
+	}
+	return "overwrite"
+}
+
+// ----------------------------------------------------------------------------
+// Image format
+// ----------------------------------------------------------------------------
+type ImageFormat string
+
+const (
+	FormatSame ImageFormat = "same" // same as input format
+	FormatJpeg ImageFormat = "jpeg"
+	FormatPng  ImageFormat = "png"
+	FormatGif  ImageFormat = "gif"
+)
+
+func ParseImageFormat(s string) (ImageFormat, error) {
+	switch strings.ToLower(s) {
+	case "same", "":
+		return FormatSame, nil
+	case "jpeg", "jpg":
+		return FormatJpeg, nil
+	case "png":
+		return FormatPng, nil
+	case "gif":
+		return FormatGif, nil
+	}
+	return FormatSame, errors.New("Unknown image format : " + s)
+}
+
+// Get image format from file extension. Returns empty string if not supported.
+func ImageFormatOf(filename string) ImageFormat {
+	switch getExt(filename) {
+	case ".jpg", ".jpeg":
+		return FormatJpeg
+	case ".png":
+		return FormatPng
+	case ".gif":
+		return FormatGif
+	}
+	return ""
+}
+
+// File extension of image format
+func (f ImageFormat) Ext() string {
+	switch f {
+	case FormatPng:
+		return ".png"
+	case FormatGif:
+		return ".gif"
+	}
+	return ".jpg"
+}
+
+func ParsePngCompression(s string) (png.CompressionLevel, error) {
+	switch strings.ToLower(s) {
+	case "default", "":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "speed":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	}
+	return png.DefaultCompression, errors.New("Unknown png compression : " + s)
+}
+
+// ----------------------------------------------------------------------------
+// Output option
+// ----------------------------------------------------------------------------
+type OutputOption struct {
+	Format         ImageFormat
+	Quality        int // jpeg quality (1~100)
+	PngCompression png.CompressionLevel
+	Overwrite      OverwritePolicy
+}
+
+func DefaultOutputOption() OutputOption {
+	return OutputOption{
+		Format:         FormatJpeg,
+		Quality:        80,
+		PngCompression: png.DefaultCompression,
+		Overwrite:      OverwriteExisting,
+	}
+}
+
+// Output image format of srcFilename
+func (o OutputOption) FormatOf(srcFilename string) ImageFormat {
+	if o.Format != FormatSame && o.Format != "" {
+		return o.Format
+	}
+	if format := ImageFormatOf(srcFilename); format != "" {
+		return format
+	}
+	// source format cannot be encoded (ex: TIFF, BMP). save as lossless format.
+	return FormatPng
+}
+
+// Output filename of srcFilename. Extension is replaced to match output format.
+func (o OutputOption) Filename(srcFilename string) string {
+	format := o.FormatOf(srcFilename)
+	if ImageFormatOf(srcFilename) == format {
+		return srcFilename
+	}
+	return strings.TrimSuffix(srcFilename, filepath.Ext(srcFilename)) + format.Ext()
+}
+
+// Encode image in output format of srcFilename
+func (o OutputOption) Encode(w io.Writer, img image.Image, srcFilename string) error {
+	switch o.FormatOf(srcFilename) {
+	case FormatPng:
+		encoder := png.Encoder{CompressionLevel: o.PngCompression}
+		return encoder.Encode(w, img)
+	case FormatGif:
+		return gif.Encode(w, img, nil)
+	}
+
+	quality := o.Quality
+	if quality <= 0 {
+		quality = jpeg.DefaultQuality
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// ----------------------------------------------------------------------------
+// Write
+// ----------------------------------------------------------------------------
+
+// AtomicFile is written to temp file in the same directory, and renamed to filename on Commit() after fsync.
+// Readers of filename never see partially written file.
+type AtomicFile struct {
+	*bufio.Writer
+	file     *os.File
+	filename string
+}
+
+// Create temp file of filename
+func CreateAtomicFile(filename string) (*AtomicFile, error) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	// temp file is hidden and does not have image extension
+	file, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{bufio.NewWriter(file), file, filename}, nil
+}
+
+// Flush and rename temp file to filename. Temp file is removed on error.
+func (f *AtomicFile) Commit() error {
+	if err := f.finish(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := os.Rename(f.file.Name(), f.filename); err != nil {
+		f.Abort()
+		return err
+	}
+	return nil
+}
+
+// Commit temp file according to overwrite policy. Existing file is replaced only by OverwriteExisting.
+// Name is reserved atomically, so writers of the same filename never pick the same version.
+// Returns path of written file, or empty string if skipped.
+func (f *AtomicFile) CommitAs(policy OverwritePolicy) (string, error) {
+	if policy == OverwriteExisting {
+		return f.filename, f.Commit()
+	}
+
+	if err := f.finish(); err != nil {
+		f.Abort()
+		return "", err
+	}
+	defer os.Remove(f.file.Name())
+
+	ext := filepath.Ext(f.filename)
+	name := strings.TrimSuffix(f.filename, ext)
+	for version := 0; ; version++ {
+		destFilename := f.filename
+		if version > 0 {
+			destFilename = fmt.Sprintf("%v_%v%v", name, version, ext)
+		}
+
+		err := linkNewFile(f.file.Name(), destFilename)
+		if err == nil {
+			return destFilename, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		if policy == SkipExisting {
+			return "", nil
+		}
+	}
+}
+
+// Flush and close temp file
+func (f *AtomicFile) finish() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	if err := f.file.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	return f.file.Close()
+}
+
+// Remove temp file
+func (f *AtomicFile) Abort() error {
+	f.file.Close()
+	return os.Remove(f.file.Name())
+}
+
+// Write file to temp file in the same directory, and rename it to filename after fsync.
+// Readers of filename never see partially written file.
+func WriteFileAtomic(filename string, write func(w io.Writer) error) error {
+	file, err := CreateAtomicFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := write(file); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+// Write file atomically according to overwrite policy. Returns path of written file, or empty string if skipped.
+func writeFileAs(filename string, policy OverwritePolicy, write func(w io.Writer) error) (string, error) {
+	// existing file is not encoded again
+	if policy == SkipExisting && fileExists(filename) {
+		return "", nil
+	}
+
+	file, err := CreateAtomicFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if err := write(file); err != nil {
+		file.Abort()
+		return "", err
+	}
+	return file.CommitAs(policy)
+}
+
+// Create filename with content of tempFilename. Returns error satisfying os.IsExist() if filename exists.
+func linkNewFile(tempFilename, filename string) error {
+	err := os.Link(tempFilename, filename)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+
+	// file system without hard link : reserve filename and replace it with temp file
+	file, err := os.OpenFile(filename, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Rename(tempFilename, filename)
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// Save image to dir. Output filename is derived from srcFilename by option.Filename().
+// Returns path of written file, or empty string if skipped by overwrite policy.
+func SaveImage(img image.Image, dir string, srcFilename string, option OutputOption) (string, error) {
+	return saveImageAs(img, filepath.Join(dir, option.Filename(srcFilename)), srcFilename, option)
+}
+
+// Save image to filename in output format of srcFilename.
+// Returns path of written file, or empty string if skipped by overwrite policy.
+func saveImageAs(img image.Image, filename string, srcFilename string, option OutputOption) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return "", err
+	}
+
+	return writeFileAs(filename, option.Overwrite, func(w io.Writer) error {
+		return option.Encode(w, img, srcFilename)
+	})
+}
@@ -0,0 +1,163 @@
+package ip
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveImageOverwritePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := CreateImage(10, 10, color.White)
+	filename := filepath.Join(dir, "page1.jpg")
+
+	tests := []struct {
+		policy   OverwritePolicy
+		expected string
+	}{
+		{OverwriteExisting, filename},
+		{OverwriteExisting, filename},
+		{SkipExisting, ""},
+		{VersionExisting, filepath.Join(dir, "page1_1.jpg")},
+		{VersionExisting, filepath.Join(dir, "page1_2.jpg")},
+	}
+	for _, test := range tests {
+		destFilename, err := SaveImage(img, dir, "page1.jpg", OutputOption{Overwrite: test.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if destFilename != test.expected {
+			t.Errorf("dest mismatch. policy=%v, expected=%v, actual=%v", test.policy, test.expected, destFilename)
+		}
+	}
+
+	// temp files are removed
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Errorf("file count mismatch. expected=3, actual=%v", len(files))
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	for _, s := range []string{"overwrite", "skip", "version"} {
+		policy, err := ParseOverwritePolicy(s)
+		if err != nil || policy.String() != s {
+			t.Errorf("parse failed : %v : %v", s, err)
+		}
+	}
+	if _, err := ParseOverwritePolicy("unknown"); err == nil {
+		t.Errorf("expected error for unknown policy")
+	}
+}
+
+func TestSaveImageFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := CreateImage(10, 10, color.White)
+
+	tests := []struct {
+		format   ImageFormat
+		src      string
+		expected string
+	}{
+		{FormatJpeg, "page1.png", "page1.jpg"},
+		{FormatJpeg, "page2.jpeg", "page2.jpeg"},
+		{FormatPng, "page3.jpg", "page3.png"},
+		{FormatGif, "page4.jpg", "page4.gif"},
+		{FormatSame, "page5.png", "page5.png"},
+		{FormatSame, "page6.gif", "page6.gif"},
+	}
+	for _, test := range tests {
+		option := DefaultOutputOption()
+		option.Format = test.format
+		destFilename, err := SaveImage(img, dir, test.src, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(destFilename) != test.expected {
+			t.Errorf("dest mismatch. format=%v, expected=%v, actual=%v", test.format, test.expected, destFilename)
+			continue
+		}
+
+		// check real encoding
+		file, err := os.Open(destFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, format, err := image.DecodeConfig(file)
+		file.Close()
+		if err != nil || ImageFormat(format) != option.FormatOf(test.src) {
+			t.Errorf("encoding mismatch. file=%v, format=%v, err=%v", test.expected, format, err)
+		}
+	}
+}
+
+func TestParseImageFormat(t *testing.T) {
+	tests := map[string]ImageFormat{
+		"jpeg": FormatJpeg,
+		"JPG":  FormatJpeg,
+		"png":  FormatPng,
+		"gif":  FormatGif,
+		"same": FormatSame,
+	}
+	for s, expected := range tests {
+		format, err := ParseImageFormat(s)
+		if err != nil || format != expected {
+			t.Errorf("parse failed : %v : %v", s, err)
+		}
+	}
+	if _, err := ParseImageFormat("bmp"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+	if _, err := ParsePngCompression("fast"); err == nil {
+		t.Errorf("expected error for unknown png compression")
+	}
+}
+
+func TestSaveImageVersionConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// writers of the same name get different versions
+	img := CreateImage(10, 10, color.White)
+	count := 8
+	dests := make(chan string, count)
+	for i := 0; i < count; i++ {
+		go func() {
+			destFilename, err := SaveImage(img, dir, "page1.jpg", OutputOption{Overwrite: VersionExisting})
+			if err != nil {
+				t.Error(err)
+			}
+			dests <- destFilename
+		}()
+	}
+
+	written := make(map[string]bool)
+	for i := 0; i < count; i++ {
+		destFilename := <-dests
+		if written[destFilename] {
+			t.Errorf("dest is written twice : %v", destFilename)
+		}
+		written[destFilename] = true
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != count {
+		t.Errorf("file count mismatch. expected=%v, actual=%v", count, len(files))
+	}
+}
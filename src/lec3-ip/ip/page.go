@@ -0,0 +1,245 @@
+package ip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"golang.org/x/image/tiff"
+)
+
+// ----------------------------------------------------------------------------
+// Image page
+// ----------------------------------------------------------------------------
+
+// Page of image file. Multi-page file (ex: TIFF) and archive (ex: CBZ) have a page for each image.
+type ImagePage struct {
+	Filename string // source filename
+	Index    int    // page index starting from 0
+	Count    int    // number of pages in source file
+	Entry    string // image entry path in archive. empty if source is not an archive
+}
+
+// Single page of filename
+func NewImagePage(filename string) ImagePage {
+	return ImagePage{Filename: filename, Index: 0, Count: 1}
+}
+
+// Check if source file has multiple pages
+func (p ImagePage) IsMultiPage() bool {
+	return p.Count > 1
+}
+
+// Output base name of page. Page number is added for multi-page file and PDF file. ex) scan_002.tif
+// Archive entry keeps its name.
+func (p ImagePage) Name() string {
+	if p.Entry != "" {
+		return path.Base(p.Entry)
+	}
+
+	base := filepath.Base(p.Filename)
+	if !p.IsMultiPage() && !isPdf(getExt(base)) {
+		return base
+	}
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%v_%03d%v", strings.TrimSuffix(base, ext), p.Index + 1, ext)
+}
+
+// Output directory of page relative to dest directory.
+// Pages of archive are written to a directory named after the archive. ex) book.cbz : book/ch1
+func (p ImagePage) Dir() string {
+	if p.Entry == "" {
+		return ""
+	}
+	base := filepath.Base(p.Filename)
+	return path.Join(strings.TrimSuffix(base, filepath.Ext(base)), path.Dir(p.Entry))
+}
+
+// Decode image of page
+func (p ImagePage) Load() (image.Image, error) {
+	if p.Entry != "" {
+		return loadArchiveEntry(p.Filename, p.Entry)
+	}
+	if isPdf(getExt(p.Filename)) {
+		return loadPdfPage(p.Filename, p.Index)
+	}
+	if !p.IsMultiPage() {
+		return LoadImage(p.Filename)
+	}
+
+	switch getExt(p.Filename) {
+	case ".tif", ".tiff":
+		return loadTiffPage(p.Filename, p.Index)
+	}
+	return nil, errors.New("Unsupported multi-page file format : " + p.Filename)
+}
+
+// List pages of image file. Images in archive are listed in natural order.
+// Pages of PDF file are the pages with embedded image.
+func ListPages(filename string) ([]ImagePage, error) {
+	if isArchive(getExt(filename)) {
+		return listArchivePages(filename)
+	}
+	if isPdf(getExt(filename)) {
+		return listPdfPages(filename)
+	}
+
+	count := 1
+	switch getExt(filename) {
+	case ".tif", ".tiff":
+		offsets, err := readTiffOffsets(filename)
+		if err != nil {
+			return nil, err
+		}
+		count = len(offsets)
+	}
+
+	var pages []ImagePage
+	for i := 0; i < count; i++ {
+		pages = append(pages, ImagePage{filename, i, count, ""})
+	}
+	return pages, nil
+}
+
+// ----------------------------------------------------------------------------
+// Multi-page TIFF
+// ----------------------------------------------------------------------------
+
+// maximum number of pages read from TIFF file
+const maxTiffPages = 10000
+
+type tiffFile struct {
+	r         io.ReaderAt
+	byteOrder binary.ByteOrder
+}
+
+func newTiffFile(r io.ReaderAt) (*tiffFile, error) {
+	header := make([]byte, 4)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	var byteOrder binary.ByteOrder
+	switch string(header[0:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return nil, errors.New("Invalid TIFF header")
+	}
+	if byteOrder.Uint16(header[2:4]) != 42 {
+		return nil, errors.New("Invalid TIFF header")
+	}
+	return &tiffFile{r, byteOrder}, nil
+}
+
+func (t *tiffFile) readUint32(offset int64) (uint32, error) {
+	buf := make([]byte, 4)
+	if _, err := t.r.ReadAt(buf, offset); err != nil {
+		return 0, err
+	}
+	return t.byteOrder.Uint32(buf), nil
+}
+
+// Offsets of image file directories. Each IFD is a page.
+func (t *tiffFile) ifdOffsets() ([]uint32, error) {
+	offset, err := t.readUint32(4)
+	if err != nil {
+		return nil, err
+	}
+
+	var offsets []uint32
+	visited := make(map[uint32]bool)
+	for offset != 0 && !visited[offset] && len(offsets) < maxTiffPages {
+		visited[offset] = true
+		offsets = append(offsets, offset)
+
+		buf := make([]byte, 2)
+		if _, err := t.r.ReadAt(buf, int64(offset)); err != nil {
+			return nil, err
+		}
+		entryCount := int64(t.byteOrder.Uint16(buf))
+
+		// next IFD offset follows 12 byte entries
+		if offset, err = t.readUint32(int64(offset) + 2 + entryCount * 12); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(offsets) == 0 {
+		return nil, errors.New("TIFF file has no image")
+	}
+	return offsets, nil
+}
+
+func readTiffOffsets(filename string) ([]uint32, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	t, err := newTiffFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return t.ifdOffsets()
+}
+
+// tiffPageReader reads TIFF file with first IFD offset in header replaced to offset of other page.
+// tiff.Decode() decodes first IFD only.
+type tiffPageReader struct {
+	r      io.ReaderAt
+	header [8]byte
+}
+
+func (t *tiffPageReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.r.ReadAt(p, off)
+	for i := 0; i < n; i++ {
+		pos := off + int64(i)
+		if pos >= int64(len(t.header)) {
+			break
+		}
+		p[i] = t.header[pos]
+	}
+	return n, err
+}
+
+func loadTiffPage(filename string, index int) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newTiffFile(file)
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := t.ifdOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(offsets) {
+		return nil, fmt.Errorf("TIFF page out of range : %v", index + 1)
+	}
+
+	reader := &tiffPageReader{r: file}
+	if _, err := file.ReadAt(reader.header[0:4], 0); err != nil {
+		return nil, err
+	}
+	t.byteOrder.PutUint32(reader.header[4:8], offsets[index])
+
+	return tiff.Decode(io.NewSectionReader(reader, 0, stat.Size()))
+}
@@ -0,0 +1,142 @@
+package ip
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Create uncompressed grayscale TIFF file with a page for each image
+func createTestTiff(t *testing.T, filename string, pages []*image.Gray) {
+	le := binary.LittleEndian
+	data := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	nextOffsetPos := 4
+
+	for _, page := range pages {
+		width, height := page.Bounds().Dx(), page.Bounds().Dy()
+		stripOffset := len(data)
+		data = append(data, page.Pix...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+
+		// link IFD from previous IFD
+		le.PutUint32(data[nextOffsetPos:], uint32(len(data)))
+
+		entries := [][3]uint32{
+			{256, 4, uint32(width)},          // ImageWidth
+			{257, 4, uint32(height)},         // ImageLength
+			{258, 3, 8},                      // BitsPerSample
+			{259, 3, 1},                      // Compression : none
+			{262, 3, 1},                      // PhotometricInterpretation : BlackIsZero
+			{273, 4, uint32(stripOffset)},    // StripOffsets
+			{278, 4, uint32(height)},         // RowsPerStrip
+			{279, 4, uint32(width * height)}, // StripByteCounts
+		}
+		ifd := make([]byte, 2+len(entries)*12+4)
+		le.PutUint16(ifd, uint16(len(entries)))
+		for i, entry := range entries {
+			e := ifd[2+i*12:]
+			le.PutUint16(e[0:], uint16(entry[0]))
+			le.PutUint16(e[2:], uint16(entry[1]))
+			le.PutUint32(e[4:], 1)
+			le.PutUint32(e[8:], entry[2])
+		}
+		nextOffsetPos = len(data) + len(ifd) - 4
+		data = append(data, ifd...)
+	}
+
+	if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createGrayImage(width, height int, gray uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+	return img
+}
+
+func TestMultiPageTiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "scan.tif")
+	createTestTiff(t, filename, []*image.Gray{
+		createGrayImage(10, 20, 0),
+		createGrayImage(30, 10, 128),
+		createGrayImage(4, 4, 255),
+	})
+
+	pages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 {
+		t.Fatalf("page count mismatch. expected=3, actual=%v", len(pages))
+	}
+
+	expected := []struct {
+		name string
+		size image.Point
+		gray uint8
+	}{
+		{"scan_001.tif", image.Pt(10, 20), 0},
+		{"scan_002.tif", image.Pt(30, 10), 128},
+		{"scan_003.tif", image.Pt(4, 4), 255},
+	}
+	for i, page := range pages {
+		if page.Name() != expected[i].name {
+			t.Errorf("name mismatch. expected=%v, actual=%v", expected[i].name, page.Name())
+		}
+
+		img, err := page.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Size() != expected[i].size {
+			t.Errorf("size mismatch. page=%v, expected=%v, actual=%v", i, expected[i].size, img.Bounds().Size())
+		}
+		if gray := color.GrayModel.Convert(img.At(1, 1)).(color.Gray).Y; gray != expected[i].gray {
+			t.Errorf("pixel mismatch. page=%v, expected=%v, actual=%v", i, expected[i].gray, gray)
+		}
+	}
+}
+
+func TestSinglePage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "single.tiff")
+	createTestTiff(t, filename, []*image.Gray{createGrayImage(8, 8, 64)})
+
+	pages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Name() != "single.tiff" {
+		t.Fatalf("single page expected : %v", pages)
+	}
+	if _, err := LoadImage(filename); err != nil {
+		t.Error(err)
+	}
+
+	// page number is not added to output name of single page file
+	option := DefaultOutputOption()
+	option.Format = FormatSame
+	if name := option.Filename(pages[0].Name()); name != "single.png" {
+		t.Errorf("output name mismatch. expected=single.png, actual=%v", name)
+	}
+}
@@ -0,0 +1,352 @@
+package ip
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ----------------------------------------------------------------------------
+// PDF writer
+// ----------------------------------------------------------------------------
+
+type PdfOption struct {
+	Title     string  // default : book filename
+	Author    string
+	Direction string  // page progression direction. ltr or rtl
+	Dpi       float64 // resolution of pages without resolution. default : 300
+}
+
+// object numbers of document catalog and page tree. other objects are numbered in written order.
+const (
+	pdfCatalogObject = 1
+	pdfPagesObject   = 2
+)
+
+// PdfWriter writes each page as an image-only page of PDF file.
+// JPEG image is embedded without re-encoding (DCTDecode), and other images are compressed losslessly (FlateDecode).
+// Page size is image size in resolution of the page.
+type PdfWriter struct {
+	file    *AtomicFile
+	option  PdfOption
+	offset  int64   // bytes written
+	offsets []int64 // offsets of objects. index : object number - 1
+	pages   []int   // object numbers of pages
+}
+
+func NewPdfWriter(filename string, option PdfOption) (*PdfWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	file, err := CreateAtomicFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if option.Title == "" {
+		option.Title = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	if option.Dpi <= 0 {
+		option.Dpi = 300
+	}
+
+	w := &PdfWriter{
+		file:    file,
+		option:  option,
+		offsets: make([]int64, 2),
+	}
+
+	// binary comment marks the file as binary
+	if _, err := w.write([]byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *PdfWriter) write(data []byte) (int, error) {
+	n, err := w.file.Write(data)
+	w.offset += int64(n)
+	return n, err
+}
+
+func (w *PdfWriter) printf(format string, a ...interface{}) error {
+	_, err := w.write([]byte(fmt.Sprintf(format, a...)))
+	return err
+}
+
+// Reserve object number
+func (w *PdfWriter) newObject() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *PdfWriter) beginObject(number int) error {
+	w.offsets[number - 1] = w.offset
+	return w.printf("%v 0 obj\n", number)
+}
+
+// Write object of dictionary
+func (w *PdfWriter) writeObject(number int, dict string) error {
+	if err := w.beginObject(number); err != nil {
+		return err
+	}
+	return w.printf("%v\nendobj\n", dict)
+}
+
+// Write stream object. dict does not contain /Length.
+func (w *PdfWriter) writeStream(number int, dict string, data []byte) error {
+	if err := w.beginObject(number); err != nil {
+		return err
+	}
+	if dict != "" {
+		dict += " "
+	}
+	if err := w.printf("<< %v/Length %v >>\nstream\n", dict, len(data)); err != nil {
+		return err
+	}
+	if _, err := w.write(data); err != nil {
+		return err
+	}
+	return w.printf("\nendstream\nendobj\n")
+}
+
+// Escape PDF literal string. Non-ASCII string is written in UTF-16BE hex string with byte order mark,
+// because literal string is read as PDFDocEncoding.
+func pdfString(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return pdfUtf16String(s)
+		}
+	}
+	replacer := strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)", "\r", "\\r", "\n", "\\n")
+	return "(" + replacer.Replace(s) + ")"
+}
+
+func pdfUtf16String(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<FEFF")
+	for _, c := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&buf, "%04X", c)
+	}
+	buf.WriteString(">")
+	return buf.String()
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write image XObject of page. Returns object number of the image.
+func (w *PdfWriter) writeImage(page *BookPage) (int, error) {
+	if page.Format == FormatJpeg {
+		return w.writeJpeg(page.Data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(page.Data))
+	if err != nil {
+		return 0, err
+	}
+	return w.writeFlateImage(img)
+}
+
+func (w *PdfWriter) writeJpeg(data []byte) (int, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	colorSpace := "/DeviceRGB"
+	switch config.ColorModel {
+	case color.GrayModel:
+		colorSpace = "/DeviceGray"
+	case color.CMYKModel:
+		// Adobe CMYK JPEG is inverted
+		colorSpace = "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+	}
+
+	number := w.newObject()
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %v /Height %v /ColorSpace %v /BitsPerComponent 8 /Filter /DCTDecode",
+		config.Width, config.Height, colorSpace)
+	return number, w.writeStream(number, dict, data)
+}
+
+// Write 8 bit samples of image compressed losslessly. Alpha channel is written to soft mask.
+func (w *PdfWriter) writeFlateImage(img image.Image) (int, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	_, isGray := img.(*image.Gray)
+	opaque := true
+	if o, ok := img.(interface {
+		Opaque() bool
+	}); ok {
+		opaque = o.Opaque()
+	}
+
+	components := 3
+	colorSpace := "/DeviceRGB"
+	if isGray {
+		components = 1
+		colorSpace = "/DeviceGray"
+	}
+
+	samples := make([]byte, 0, width * height * components)
+	var alpha []byte
+	if !opaque {
+		alpha = make([]byte, 0, width * height)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isGray {
+				samples = append(samples, img.(*image.Gray).GrayAt(x, y).Y)
+				continue
+			}
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			samples = append(samples, c.R, c.G, c.B)
+			if alpha != nil {
+				alpha = append(alpha, c.A)
+			}
+		}
+	}
+
+	smask := ""
+	if alpha != nil {
+		data, err := deflate(alpha)
+		if err != nil {
+			return 0, err
+		}
+		number := w.newObject()
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %v /Height %v /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+			width, height)
+		if err := w.writeStream(number, dict, data); err != nil {
+			return 0, err
+		}
+		smask = fmt.Sprintf(" /SMask %v 0 R", number)
+	}
+
+	data, err := deflate(samples)
+	if err != nil {
+		return 0, err
+	}
+	number := w.newObject()
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %v /Height %v /ColorSpace %v /BitsPerComponent 8 /Filter /FlateDecode%v",
+		width, height, colorSpace, smask)
+	return number, w.writeStream(number, dict, data)
+}
+
+func (w *PdfWriter) WritePage(page *BookPage) error {
+	imageNumber, err := w.writeImage(page)
+	if err != nil {
+		return err
+	}
+
+	// page size in points (1/72 inch)
+	dpi := page.Dpi
+	if dpi <= 0 {
+		dpi = w.option.Dpi
+	}
+	width := float64(page.Width) * 72 / dpi
+	height := float64(page.Height) * 72 / dpi
+
+	contentNumber := w.newObject()
+	content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", width, height)
+	if err := w.writeStream(contentNumber, "", []byte(content)); err != nil {
+		return err
+	}
+
+	pageNumber := w.newObject()
+	dict := fmt.Sprintf("<< /Type /Page /Parent %v 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %v 0 R >> >> /Contents %v 0 R >>",
+		pdfPagesObject, width, height, imageNumber, contentNumber)
+	if err := w.writeObject(pageNumber, dict); err != nil {
+		return err
+	}
+
+	w.pages = append(w.pages, pageNumber)
+	return nil
+}
+
+// Write page tree, catalog, document information, cross-reference table and trailer
+func (w *PdfWriter) writeTrailer() error {
+	var kids bytes.Buffer
+	for _, number := range w.pages {
+		fmt.Fprintf(&kids, "%v 0 R ", number)
+	}
+	if err := w.writeObject(pdfPagesObject, fmt.Sprintf("<< /Type /Pages /Kids [ %v] /Count %v >>", kids.String(), len(w.pages))); err != nil {
+		return err
+	}
+
+	catalog := fmt.Sprintf("<< /Type /Catalog /Pages %v 0 R", pdfPagesObject)
+	if w.option.Direction == "rtl" {
+		catalog += " /ViewerPreferences << /Direction /R2L >>"
+	}
+	if err := w.writeObject(pdfCatalogObject, catalog + " >>"); err != nil {
+		return err
+	}
+
+	infoNumber := w.newObject()
+	info := "<< /Title " + pdfString(w.option.Title)
+	if w.option.Author != "" {
+		info += " /Author " + pdfString(w.option.Author)
+	}
+	info += " /Producer (lec3-ip) /CreationDate " + pdfString(time.Now().Format("D:20060102150405")) + " >>"
+	if err := w.writeObject(infoNumber, info); err != nil {
+		return err
+	}
+
+	// each entry is 20 bytes
+	xrefOffset := w.offset
+	if err := w.printf("xref\n0 %v\n0000000000 65535 f \n", len(w.offsets) + 1); err != nil {
+		return err
+	}
+	for _, offset := range w.offsets {
+		if err := w.printf("%010d 00000 n \n", offset); err != nil {
+			return err
+		}
+	}
+	return w.printf("trailer\n<< /Size %v /Root %v 0 R /Info %v 0 R >>\nstartxref\n%v\n%%%%EOF\n",
+		len(w.offsets) + 1, pdfCatalogObject, infoNumber, xrefOffset)
+}
+
+func (w *PdfWriter) Close() error {
+	if len(w.pages) == 0 {
+		w.Abort()
+		return errors.New("PDF has no page")
+	}
+	if err := w.writeTrailer(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.file.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("[BOOK] %v : %v pages\n", w.file.filename, len(w.pages))
+	return nil
+}
+
+func (w *PdfWriter) Abort() error {
+	return w.file.Abort()
+}
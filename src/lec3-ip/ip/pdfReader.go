@@ -0,0 +1,1423 @@
+package ip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/disintegration/gift"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// PDF objects
+// ----------------------------------------------------------------------------
+
+type pdfName string
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfDict map[pdfName]interface{}
+
+type pdfArray []interface{}
+
+type pdfStream struct {
+	dict   pdfDict
+	offset int64 // offset of stream data in file
+}
+
+// keyword of PDF syntax. ex) obj, stream, R
+type pdfKeyword string
+
+// ----------------------------------------------------------------------------
+// PDF lexer
+// ----------------------------------------------------------------------------
+
+var errPdfSyntax = errors.New("Invalid PDF syntax")
+
+func isPdfSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPdfDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLexer reads tokens of PDF syntax from offset
+type pdfLexer struct {
+	r      *bufio.Reader
+	pos    int64         // absolute offset of next byte
+	tokens []interface{} // tokens pushed back
+}
+
+func newPdfLexer(r io.ReaderAt, offset int64, size int64) *pdfLexer {
+	return &pdfLexer{r: bufio.NewReader(io.NewSectionReader(r, offset, size - offset)), pos: offset}
+}
+
+func (l *pdfLexer) readByte() (byte, error) {
+	c, err := l.r.ReadByte()
+	if err == nil {
+		l.pos++
+	}
+	return c, err
+}
+
+func (l *pdfLexer) unreadByte() {
+	l.r.UnreadByte()
+	l.pos--
+}
+
+func (l *pdfLexer) unread(token interface{}) {
+	l.tokens = append(l.tokens, token)
+}
+
+func (l *pdfLexer) skipSpace() error {
+	for {
+		c, err := l.readByte()
+		if err != nil {
+			return err
+		}
+		if c == '%' {
+			// comment
+			for c != '\r' && c != '\n' {
+				if c, err = l.readByte(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isPdfSpace(c) {
+			l.unreadByte()
+			return nil
+		}
+	}
+}
+
+// Read regular characters
+func (l *pdfLexer) readRegular() []byte {
+	var buf []byte
+	for {
+		c, err := l.readByte()
+		if err != nil {
+			return buf
+		}
+		if isPdfSpace(c) || isPdfDelimiter(c) {
+			l.unreadByte()
+			return buf
+		}
+		buf = append(buf, c)
+	}
+}
+
+// Read next token. Returns pdfName, pdfKeyword, int64, float64, string or delimiter keyword ("[", "]", "<<", ">>").
+func (l *pdfLexer) next() (interface{}, error) {
+	if n := len(l.tokens); n > 0 {
+		token := l.tokens[n - 1]
+		l.tokens = l.tokens[:n - 1]
+		return token, nil
+	}
+
+	if err := l.skipSpace(); err != nil {
+		return nil, err
+	}
+	c, err := l.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch c {
+	case '[', ']', '{', '}':
+		return pdfKeyword(c), nil
+	case '/':
+		return pdfName(decodePdfName(l.readRegular())), nil
+	case '(':
+		return l.readLiteralString()
+	case '<':
+		c, err := l.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == '<' {
+			return pdfKeyword("<<"), nil
+		}
+		l.unreadByte()
+		return l.readHexString()
+	case '>':
+		c, err := l.readByte()
+		if err != nil || c != '>' {
+			return nil, errPdfSyntax
+		}
+		return pdfKeyword(">>"), nil
+	case ')':
+		return nil, errPdfSyntax
+	}
+
+	l.unreadByte()
+	word := l.readRegular()
+	if len(word) == 0 {
+		return nil, errPdfSyntax
+	}
+	if i, err := strconv.ParseInt(string(word), 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(string(word), 64); err == nil {
+		return f, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// Decode #xx escapes of name
+func decodePdfName(b []byte) string {
+	var buf []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i + 2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i + 1:i + 3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				i += 2
+				continue
+			}
+		}
+		buf = append(buf, b[i])
+	}
+	return string(buf)
+}
+
+func (l *pdfLexer) readLiteralString() (string, error) {
+	var buf []byte
+	depth := 1
+	for {
+		c, err := l.readByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return string(buf), nil
+			}
+		case '\\':
+			if c, err = l.readByte(); err != nil {
+				return "", err
+			}
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// line continuation
+				continue
+			default:
+				if '0' <= c && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2; i++ {
+						d, err := l.readByte()
+						if err != nil {
+							return "", err
+						}
+						if d < '0' || d > '7' {
+							l.unreadByte()
+							break
+						}
+						v = v * 8 + int(d - '0')
+					}
+					c = byte(v)
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+}
+
+func (l *pdfLexer) readHexString() (string, error) {
+	var digits []byte
+	for {
+		c, err := l.readByte()
+		if err != nil {
+			return "", err
+		}
+		if c == '>' {
+			break
+		}
+		if !isPdfSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits) % 2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	buf := make([]byte, len(digits) / 2)
+	for i := range buf {
+		v, err := strconv.ParseUint(string(digits[i * 2:i * 2 + 2]), 16, 8)
+		if err != nil {
+			return "", errPdfSyntax
+		}
+		buf[i] = byte(v)
+	}
+	return string(buf), nil
+}
+
+// Read value. Indirect reference (n g R) is returned as pdfRef.
+func (l *pdfLexer) readValue() (interface{}, error) {
+	token, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case int64:
+		// check "gen R"
+		gen, err := l.next()
+		if err != nil {
+			return t, nil
+		}
+		if g, ok := gen.(int64); ok {
+			r, err := l.next()
+			if err == nil && r == pdfKeyword("R") {
+				return pdfRef{int(t), int(g)}, nil
+			}
+			if err == nil {
+				l.unread(r)
+			}
+		}
+		l.unread(gen)
+		return t, nil
+	case pdfKeyword:
+		switch t {
+		case "[":
+			var array pdfArray
+			for {
+				token, err := l.next()
+				if err != nil {
+					return nil, err
+				}
+				if token == pdfKeyword("]") {
+					return array, nil
+				}
+				l.unread(token)
+				value, err := l.readValue()
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+		case "<<":
+			dict := make(pdfDict)
+			for {
+				token, err := l.next()
+				if err != nil {
+					return nil, err
+				}
+				if token == pdfKeyword(">>") {
+					return dict, nil
+				}
+				key, ok := token.(pdfName)
+				if !ok {
+					return nil, errPdfSyntax
+				}
+				value, err := l.readValue()
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return token, nil
+}
+
+// ----------------------------------------------------------------------------
+// PDF reader
+// ----------------------------------------------------------------------------
+
+type pdfXrefEntry struct {
+	inStream bool  // object is in object stream
+	offset   int64 // offset of object, or object number of object stream
+	index    int   // index in object stream
+}
+
+// pdfReader reads objects of PDF file using cross-reference table or stream.
+// Copy of reader with other r of same file shares parsed objects.
+type pdfReader struct {
+	r           io.ReaderAt
+	size        int64
+	xref        map[int]pdfXrefEntry
+	trailer     pdfDict
+	objStms     map[int][]interface{} // parsed objects of object streams
+	objStmsLock *sync.Mutex
+}
+
+func newPdfReader(r io.ReaderAt, size int64) (*pdfReader, error) {
+	p := &pdfReader{
+		r:           r,
+		size:        size,
+		xref:        make(map[int]pdfXrefEntry),
+		objStms:     make(map[int][]interface{}),
+		objStmsLock: &sync.Mutex{},
+	}
+
+	offset, err := p.findStartXref()
+	if err != nil {
+		return nil, err
+	}
+
+	// newer sections come first. entries of previous sections do not override.
+	visited := make(map[int64]bool)
+	for offset > 0 && !visited[offset] {
+		visited[offset] = true
+		trailer, err := p.readXref(offset)
+		if err != nil {
+			return nil, err
+		}
+		if p.trailer == nil {
+			p.trailer = trailer
+		}
+		// hybrid file has cross-reference stream for objects in object streams
+		if xrefStm, ok := trailer["XRefStm"].(int64); ok && !visited[xrefStm] {
+			visited[xrefStm] = true
+			if _, err := p.readXref(xrefStm); err != nil {
+				return nil, err
+			}
+		}
+		prev, _ := trailer["Prev"].(int64)
+		offset = prev
+	}
+
+	if p.trailer == nil {
+		return nil, errors.New("PDF trailer not found")
+	}
+	if _, ok := p.trailer["Encrypt"]; ok {
+		return nil, errors.New("Encrypted PDF is not supported")
+	}
+	return p, nil
+}
+
+func (p *pdfReader) findStartXref() (int64, error) {
+	tailSize := int64(1024)
+	if tailSize > p.size {
+		tailSize = p.size
+	}
+	tail := make([]byte, tailSize)
+	if _, err := p.r.ReadAt(tail, p.size - tailSize); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return 0, errors.New("PDF startxref not found")
+	}
+	l := newPdfLexer(bytes.NewReader(tail[i + 9:]), 0, int64(len(tail) - i - 9))
+	token, err := l.next()
+	if err != nil {
+		return 0, err
+	}
+	offset, ok := token.(int64)
+	if !ok || offset <= 0 || offset >= p.size {
+		return 0, errors.New("Invalid PDF startxref")
+	}
+	return offset, nil
+}
+
+// Read cross-reference table or stream at offset. Returns trailer dictionary.
+func (p *pdfReader) readXref(offset int64) (pdfDict, error) {
+	l := newPdfLexer(p.r, offset, p.size)
+	token, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	if token == pdfKeyword("xref") {
+		return p.readXrefTable(l)
+	}
+
+	l.unread(token)
+	value, err := p.readIndirectObject(l)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := value.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, errors.New("PDF cross-reference not found")
+	}
+	return stream.dict, p.readXrefStream(stream)
+}
+
+func (p *pdfReader) setXref(num int, entry pdfXrefEntry) {
+	if _, ok := p.xref[num]; !ok {
+		p.xref[num] = entry
+	}
+}
+
+func (p *pdfReader) readXrefTable(l *pdfLexer) (pdfDict, error) {
+	for {
+		token, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if token == pdfKeyword("trailer") {
+			break
+		}
+
+		start, ok1 := token.(int64)
+		countToken, err := l.next()
+		count, ok2 := countToken.(int64)
+		if err != nil || !ok1 || !ok2 {
+			return nil, errPdfSyntax
+		}
+
+		for i := int64(0); i < count; i++ {
+			offsetToken, _ := l.next()
+			l.next() // generation
+			typeToken, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			offset, ok := offsetToken.(int64)
+			if !ok {
+				return nil, errPdfSyntax
+			}
+			if typeToken == pdfKeyword("n") {
+				p.setXref(int(start + i), pdfXrefEntry{offset: offset})
+			} else {
+				// free entry hides object of previous sections
+				p.setXref(int(start + i), pdfXrefEntry{offset: -1})
+			}
+		}
+	}
+
+	value, err := l.readValue()
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := value.(pdfDict)
+	if !ok {
+		return nil, errPdfSyntax
+	}
+	return trailer, nil
+}
+
+func (p *pdfReader) readXrefStream(stream *pdfStream) error {
+	data, err := p.decodeStream(stream)
+	if err != nil {
+		return err
+	}
+
+	w, _ := p.resolve(stream.dict["W"]).(pdfArray)
+	if len(w) != 3 {
+		return errors.New("Invalid PDF cross-reference stream")
+	}
+	// field is 8 bytes at most
+	widths := make([]int, 3)
+	entrySize := 0
+	for i := range widths {
+		width := p.int(w[i])
+		if width < 0 || width > 8 {
+			return errors.New("Invalid PDF cross-reference stream field width")
+		}
+		widths[i] = int(width)
+		entrySize += widths[i]
+	}
+	if entrySize == 0 || entrySize > len(data) {
+		return errors.New("Invalid PDF cross-reference stream")
+	}
+
+	index, _ := p.resolve(stream.dict["Index"]).(pdfArray)
+	if index == nil {
+		index = pdfArray{int64(0), stream.dict["Size"]}
+	}
+
+	field := func(entry []byte, i int) int64 {
+		start := 0
+		for j := 0; j < i; j++ {
+			start += widths[j]
+		}
+		var v int64
+		for _, b := range entry[start:start + widths[i]] {
+			v = v << 8 | int64(b)
+		}
+		return v
+	}
+
+	pos := 0
+	for i := 0; i + 1 < len(index); i += 2 {
+		start, count := int(p.int(index[i])), int(p.int(index[i + 1]))
+		for j := 0; j < count; j++ {
+			if pos + entrySize > len(data) {
+				return nil
+			}
+			entry := data[pos:pos + entrySize]
+			pos += entrySize
+
+			entryType := int64(1)
+			if widths[0] > 0 {
+				entryType = field(entry, 0)
+			}
+			switch entryType {
+			case 0:
+				p.setXref(start + j, pdfXrefEntry{offset: -1})
+			case 1:
+				p.setXref(start + j, pdfXrefEntry{offset: field(entry, 1)})
+			case 2:
+				p.setXref(start + j, pdfXrefEntry{inStream: true, offset: field(entry, 1), index: int(field(entry, 2))})
+			}
+		}
+	}
+	return nil
+}
+
+// Read "n g obj" and its value. Stream data is not read.
+func (p *pdfReader) readIndirectObject(l *pdfLexer) (interface{}, error) {
+	for i := 0; i < 2; i++ {
+		if token, err := l.next(); err != nil {
+			return nil, err
+		} else if _, ok := token.(int64); !ok {
+			return nil, errPdfSyntax
+		}
+	}
+	if token, err := l.next(); err != nil || token != pdfKeyword("obj") {
+		return nil, errPdfSyntax
+	}
+
+	value, err := l.readValue()
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(pdfDict)
+	if !ok {
+		return value, nil
+	}
+
+	token, err := l.next()
+	if err != nil || token != pdfKeyword("stream") {
+		return dict, nil
+	}
+
+	// stream keyword is followed by CRLF or LF
+	c, err := l.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if c == '\r' {
+		if c, err = l.readByte(); err == nil && c != '\n' {
+			l.unreadByte()
+		}
+	} else if c != '\n' {
+		l.unreadByte()
+	}
+	return &pdfStream{dict: dict, offset: l.pos}, nil
+}
+
+// Get object by object number
+func (p *pdfReader) object(num int) (interface{}, error) {
+	return p.objectOf(num, make(map[int]bool))
+}
+
+// Get object by object number. visited is object streams being read, to stop object stream containing itself.
+func (p *pdfReader) objectOf(num int, visited map[int]bool) (interface{}, error) {
+	entry, ok := p.xref[num]
+	if !ok || entry.offset < 0 {
+		return nil, nil
+	}
+
+	if entry.inStream {
+		objects, err := p.objectStream(int(entry.offset), visited)
+		if err != nil {
+			return nil, err
+		}
+		if entry.index < 0 || entry.index >= len(objects) {
+			return nil, errors.New("Invalid PDF object stream index")
+		}
+		return objects[entry.index], nil
+	}
+
+	return p.readIndirectObject(newPdfLexer(p.r, entry.offset, p.size))
+}
+
+// Objects of object stream
+func (p *pdfReader) objectStream(num int, visited map[int]bool) ([]interface{}, error) {
+	p.objStmsLock.Lock()
+	objects, ok := p.objStms[num]
+	p.objStmsLock.Unlock()
+	if ok {
+		return objects, nil
+	}
+	if visited[num] {
+		return nil, errors.New("Recursive PDF object stream")
+	}
+	visited[num] = true
+
+	value, err := p.objectOf(num, visited)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := value.(*pdfStream)
+	if !ok {
+		return nil, errors.New("PDF object stream not found")
+	}
+	data, err := p.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	n, first := p.int(stream.dict["N"]), p.int(stream.dict["First"])
+	if n < 0 || n > int64(len(data)) || first < 0 || first >= int64(len(data)) {
+		return nil, errors.New("Invalid PDF object stream")
+	}
+	l := newPdfLexer(bytes.NewReader(data), 0, int64(len(data)))
+	offsets := make([]int64, n)
+	for i := range offsets {
+		l.next() // object number
+		token, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		offsets[i], _ = token.(int64)
+	}
+
+	objects = make([]interface{}, n)
+	for i, offset := range offsets {
+		if offset < 0 || offset >= int64(len(data)) - first {
+			return nil, errPdfSyntax
+		}
+		if objects[i], err = newPdfLexer(bytes.NewReader(data), first + offset, int64(len(data))).readValue(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.objStmsLock.Lock()
+	p.objStms[num] = objects
+	p.objStmsLock.Unlock()
+	return objects, nil
+}
+
+// Resolve indirect reference. Other values are returned as it is.
+func (p *pdfReader) resolve(value interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		var err error
+		if value, err = p.object(ref.num); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *pdfReader) int(value interface{}) int64 {
+	switch v := p.resolve(value).(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func (p *pdfReader) float(value interface{}) float64 {
+	switch v := p.resolve(value).(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+func (p *pdfReader) dict(value interface{}) pdfDict {
+	dict, _ := p.resolve(value).(pdfDict)
+	return dict
+}
+
+// Raw data of stream
+func (p *pdfReader) streamData(stream *pdfStream) ([]byte, error) {
+	length := p.int(stream.dict["Length"])
+	if length < 0 || stream.offset + length > p.size {
+		return nil, errors.New("Invalid PDF stream length")
+	}
+	data := make([]byte, length)
+	if _, err := p.r.ReadAt(data, stream.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Names of filters and their parameters
+func (p *pdfReader) filters(stream *pdfStream) ([]pdfName, []pdfDict) {
+	var names []pdfName
+	var params []pdfDict
+
+	switch filter := p.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		names = append(names, filter)
+		params = append(params, p.dict(stream.dict["DecodeParms"]))
+	case pdfArray:
+		paramArray, _ := p.resolve(stream.dict["DecodeParms"]).(pdfArray)
+		for i, name := range filter {
+			n, _ := p.resolve(name).(pdfName)
+			names = append(names, n)
+			if i < len(paramArray) {
+				params = append(params, p.dict(paramArray[i]))
+			} else {
+				params = append(params, nil)
+			}
+		}
+	}
+	return names, params
+}
+
+// Decode stream data with all filters
+func (p *pdfReader) decodeStream(stream *pdfStream) ([]byte, error) {
+	data, err := p.streamData(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	names, params := p.filters(stream)
+	for i, name := range names {
+		if data, err = p.decodeFilter(name, params[i], data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (p *pdfReader) decodeFilter(name pdfName, params pdfDict, data []byte) ([]byte, error) {
+	switch name {
+	case "FlateDecode", "Fl":
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		decoded, err := ioutil.ReadAll(zr)
+		// some writers omit checksum of zlib stream
+		if err != nil && len(decoded) == 0 {
+			return nil, err
+		}
+		return p.unpredict(decoded, params)
+	}
+	return nil, errors.New("Unsupported PDF filter : " + string(name))
+}
+
+// Reverse predictor of FlateDecode
+func (p *pdfReader) unpredict(data []byte, params pdfDict) ([]byte, error) {
+	predictor := p.int(params["Predictor"])
+	if predictor <= 1 {
+		return data, nil
+	}
+
+	colors, bpc, columns := p.int(params["Colors"]), p.int(params["BitsPerComponent"]), p.int(params["Columns"])
+	if colors == 0 {
+		colors = 1
+	}
+	if bpc == 0 {
+		bpc = 8
+	}
+	if columns == 0 {
+		columns = 1
+	}
+	bpp := int((colors * bpc + 7) / 8)
+	rowSize := int((colors * bpc * columns + 7) / 8)
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("Unsupported PDF TIFF predictor : %v bits", bpc)
+		}
+		for row := 0; row + rowSize <= len(data); row += rowSize {
+			for i := bpp; i < rowSize; i++ {
+				data[row + i] += data[row + i - bpp]
+			}
+		}
+		return data, nil
+	}
+
+	// PNG predictors. each row starts with filter type.
+	var result []byte
+	prev := make([]byte, rowSize)
+	for pos := 0; pos + rowSize + 1 <= len(data); pos += rowSize + 1 {
+		filterType := data[pos]
+		row := data[pos + 1:pos + 1 + rowSize]
+		for i := 0; i < rowSize; i++ {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i - bpp], prev[i - bpp]
+			}
+			up := prev[i]
+			switch filterType {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		result = append(result, row...)
+		prev = row
+	}
+	return result, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p - int(a)), abs(p - int(b)), abs(p - int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// ----------------------------------------------------------------------------
+// PDF page images
+// ----------------------------------------------------------------------------
+
+// maximum depth of form XObjects searched for page image
+const maxPdfFormDepth = 4
+
+type pdfPage struct {
+	resources pdfDict
+	mediaBox  pdfArray
+	rotate    int
+}
+
+// Width of page in points
+func (p *pdfReader) pageWidth(page pdfPage) float64 {
+	if len(page.mediaBox) != 4 {
+		return 0
+	}
+	return p.float(page.mediaBox[2]) - p.float(page.mediaBox[0])
+}
+
+// Pages in page tree. Resources, MediaBox and Rotate are inherited from parent nodes.
+func (p *pdfReader) pages() ([]pdfPage, error) {
+	root := p.dict(p.trailer["Root"])
+	if root == nil {
+		return nil, errors.New("PDF document catalog not found")
+	}
+
+	var pages []pdfPage
+	visited := make(map[pdfRef]bool)
+
+	var walk func(value interface{}, page pdfPage) error
+	walk = func(value interface{}, page pdfPage) error {
+		if ref, ok := value.(pdfRef); ok {
+			if visited[ref] {
+				return errors.New("PDF page tree has a cycle")
+			}
+			visited[ref] = true
+		}
+		node := p.dict(value)
+		if node == nil {
+			return nil
+		}
+
+		if resources := p.dict(node["Resources"]); resources != nil {
+			page.resources = resources
+		}
+		if mediaBox, ok := p.resolve(node["MediaBox"]).(pdfArray); ok && len(mediaBox) == 4 {
+			page.mediaBox = mediaBox
+		}
+		if _, ok := node["Rotate"]; ok {
+			page.rotate = int(p.int(node["Rotate"]))
+		}
+
+		kids, ok := p.resolve(node["Kids"]).(pdfArray)
+		if !ok || node["Type"] == pdfName("Page") {
+			pages = append(pages, page)
+			return nil
+		}
+		for _, kid := range kids {
+			if err := walk(kid, page); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root["Pages"], pdfPage{}); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("PDF file has no page")
+	}
+	return pages, nil
+}
+
+// Largest image XObject of page. Images in form XObjects are also searched. Returns nil if page has no image.
+func (p *pdfReader) pageImage(page pdfPage) *pdfStream {
+	var result *pdfStream
+	var maxArea int64
+	visited := make(map[pdfRef]bool)
+
+	var search func(resources pdfDict, depth int)
+	search = func(resources pdfDict, depth int) {
+		for _, value := range p.dict(resources["XObject"]) {
+			if ref, ok := value.(pdfRef); ok {
+				if visited[ref] {
+					continue
+				}
+				visited[ref] = true
+			}
+			stream, ok := p.resolve(value).(*pdfStream)
+			if !ok {
+				continue
+			}
+
+			switch stream.dict["Subtype"] {
+			case pdfName("Image"):
+				area := p.int(stream.dict["Width"]) * p.int(stream.dict["Height"])
+				if area > maxArea {
+					result, maxArea = stream, area
+				}
+			case pdfName("Form"):
+				if depth < maxPdfFormDepth {
+					search(p.dict(stream.dict["Resources"]), depth + 1)
+				}
+			}
+		}
+	}
+
+	search(page.resources, 0)
+	return result
+}
+
+// Color space of image samples
+type pdfColorSpace struct {
+	components int           // number of components per sample
+	palette    color.Palette // colors of indexed color space
+}
+
+func (p *pdfReader) colorSpace(value interface{}) (pdfColorSpace, error) {
+	switch cs := p.resolve(value).(type) {
+	case pdfName:
+		switch cs {
+		case "DeviceGray", "G", "CalGray":
+			return pdfColorSpace{components: 1}, nil
+		case "DeviceRGB", "RGB", "CalRGB":
+			return pdfColorSpace{components: 3}, nil
+		case "DeviceCMYK", "CMYK":
+			return pdfColorSpace{components: 4}, nil
+		}
+		return pdfColorSpace{}, errors.New("Unsupported PDF color space : " + string(cs))
+	case pdfArray:
+		if len(cs) == 0 {
+			break
+		}
+		name, _ := p.resolve(cs[0]).(pdfName)
+		switch name {
+		case "CalGray", "CalRGB":
+			return p.colorSpace(name)
+		case "ICCBased":
+			if len(cs) < 2 {
+				break
+			}
+			stream, ok := p.resolve(cs[1]).(*pdfStream)
+			if !ok {
+				break
+			}
+			if n := p.int(stream.dict["N"]); n == 1 || n == 3 || n == 4 {
+				return pdfColorSpace{components: int(n)}, nil
+			}
+			return p.colorSpace(stream.dict["Alternate"])
+		case "Indexed", "I":
+			if len(cs) < 4 {
+				break
+			}
+			return p.indexedColorSpace(cs[1], int(p.int(cs[2])), cs[3])
+		}
+		return pdfColorSpace{}, errors.New("Unsupported PDF color space : " + string(name))
+	}
+	return pdfColorSpace{}, errors.New("Invalid PDF color space")
+}
+
+// Indexed color space with lookup table of base color space
+func (p *pdfReader) indexedColorSpace(baseValue interface{}, hival int, lookupValue interface{}) (pdfColorSpace, error) {
+	base, err := p.colorSpace(baseValue)
+	if err != nil {
+		return pdfColorSpace{}, err
+	}
+	if base.palette != nil || hival < 0 || hival > 255 {
+		return pdfColorSpace{}, errors.New("Invalid PDF indexed color space")
+	}
+
+	var lookup []byte
+	switch v := p.resolve(lookupValue).(type) {
+	case string:
+		lookup = []byte(v)
+	case *pdfStream:
+		if lookup, err = p.decodeStream(v); err != nil {
+			return pdfColorSpace{}, err
+		}
+	}
+	n := base.components
+	if len(lookup) < (hival + 1) * n {
+		return pdfColorSpace{}, errors.New("Invalid PDF indexed color space")
+	}
+
+	palette := make(color.Palette, hival + 1)
+	for i := range palette {
+		c := lookup[i * n:i * n + n]
+		switch n {
+		case 1:
+			palette[i] = color.Gray{c[0]}
+		case 3:
+			palette[i] = color.RGBA{c[0], c[1], c[2], 0xff}
+		case 4:
+			palette[i] = color.CMYK{c[0], c[1], c[2], c[3]}
+		}
+	}
+	return pdfColorSpace{components: 1, palette: palette}, nil
+}
+
+// Decode image XObject. JPEG image is decoded as it is, and other images are built from decoded samples.
+func (p *pdfReader) decodeImage(stream *pdfStream) (image.Image, error) {
+	data, err := p.streamData(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	names, params := p.filters(stream)
+	for i, name := range names {
+		if name == "DCTDecode" || name == "DCT" {
+			if i != len(names) - 1 {
+				return nil, errors.New("Unsupported PDF filter after DCTDecode")
+			}
+			return jpeg.Decode(bytes.NewReader(data))
+		}
+		if data, err = p.decodeFilter(name, params[i], data); err != nil {
+			return nil, err
+		}
+	}
+	return p.sampledImage(stream.dict, data)
+}
+
+// Build image from samples
+func (p *pdfReader) sampledImage(dict pdfDict, data []byte) (image.Image, error) {
+	width, height := int(p.int(dict["Width"])), int(p.int(dict["Height"]))
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("Invalid PDF image size")
+	}
+
+	var cs pdfColorSpace
+	bpc := int(p.int(dict["BitsPerComponent"]))
+	if mask, _ := p.resolve(dict["ImageMask"]).(bool); mask {
+		// stencil mask. 0 is painted in black
+		cs, bpc = pdfColorSpace{components: 1}, 1
+	} else {
+		var err error
+		if cs, err = p.colorSpace(dict["ColorSpace"]); err != nil {
+			return nil, err
+		}
+	}
+	switch bpc {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, fmt.Errorf("Unsupported PDF image bits per component : %v", bpc)
+	}
+
+	// Decode [1 0] inverts samples
+	invert := false
+	if decode, ok := p.resolve(dict["Decode"]).(pdfArray); ok && len(decode) >= 2 {
+		invert = p.float(decode[0]) > p.float(decode[1])
+	}
+
+	n := cs.components
+	rowSize := (width * n * bpc + 7) / 8
+	if len(data) < rowSize * height {
+		return nil, errors.New("PDF image data is too short")
+	}
+
+	maxValue := 1 << uint(bpc) - 1
+	// 16 bit sample is read from high byte
+	sampleMax := maxValue
+	if bpc == 16 {
+		sampleMax = 255
+	}
+	sample := func(row []byte, i int) int {
+		switch bpc {
+		case 8:
+			return int(row[i])
+		case 16:
+			return int(row[i * 2])
+		}
+		bit := i * bpc
+		shift := uint(8 - bpc - bit % 8)
+		return int(row[bit / 8] >> shift) & maxValue
+	}
+	// scale sample to 8 bits
+	value := func(row []byte, i int) uint8 {
+		v := sample(row, i) * 255 / sampleMax
+		if invert {
+			v = 255 - v
+		}
+		return uint8(v)
+	}
+
+	rect := image.Rect(0, 0, width, height)
+	if cs.palette != nil {
+		img := image.NewPaletted(rect, cs.palette)
+		for y := 0; y < height; y++ {
+			row := data[y * rowSize:]
+			for x := 0; x < width; x++ {
+				index := sample(row, x)
+				if index >= len(cs.palette) {
+					index = len(cs.palette) - 1
+				}
+				img.Pix[y * img.Stride + x] = uint8(index)
+			}
+		}
+		return img, nil
+	}
+
+	switch n {
+	case 1:
+		img := image.NewGray(rect)
+		for y := 0; y < height; y++ {
+			row := data[y * rowSize:]
+			for x := 0; x < width; x++ {
+				img.Pix[y * img.Stride + x] = value(row, x)
+			}
+		}
+		return img, nil
+	case 3:
+		img := image.NewRGBA(rect)
+		for y := 0; y < height; y++ {
+			row := data[y * rowSize:]
+			for x := 0; x < width; x++ {
+				i := y * img.Stride + x * 4
+				img.Pix[i] = value(row, x * 3)
+				img.Pix[i + 1] = value(row, x * 3 + 1)
+				img.Pix[i + 2] = value(row, x * 3 + 2)
+				img.Pix[i + 3] = 0xff
+			}
+		}
+		return img, nil
+	case 4:
+		img := image.NewCMYK(rect)
+		for y := 0; y < height; y++ {
+			row := data[y * rowSize:]
+			for x := 0; x < width * 4; x++ {
+				img.Pix[y * img.Stride + x] = value(row, x)
+			}
+		}
+		return img, nil
+	}
+	return nil, errors.New("Invalid PDF color space")
+}
+
+// Rotate image clockwise by rotation of page
+func rotatePdfPage(img image.Image, rotate int) image.Image {
+	var filter gift.Filter
+	switch (rotate % 360 + 360) % 360 {
+	case 90:
+		filter = gift.Rotate270()
+	case 180:
+		filter = gift.Rotate180()
+	case 270:
+		filter = gift.Rotate90()
+	default:
+		return img
+	}
+
+	g := gift.New(filter)
+	bounds := g.Bounds(img.Bounds())
+	if _, ok := img.(*image.Gray); ok {
+		dst := image.NewGray(bounds)
+		g.Draw(dst, img)
+		return dst
+	}
+	dst := image.NewRGBA(bounds)
+	g.Draw(dst, img)
+	return dst
+}
+
+// ----------------------------------------------------------------------------
+// PDF file
+// ----------------------------------------------------------------------------
+
+// maximum number of parsed PDF files kept
+const maxPdfDocuments = 8
+
+// Parsed PDF file. Pages of a PDF file are loaded by workers, and cross-reference and pages are read once.
+type pdfDocument struct {
+	reader  *pdfReader
+	pages   []pdfPage
+	modTime time.Time
+	size    int64
+}
+
+var pdfDocuments = make(map[string]*pdfDocument)
+var pdfDocumentNames []string // in order of parsing
+var pdfDocumentsLock sync.Mutex
+
+// Open PDF file and read pages. Caller should close the file.
+// Parsed file is reused until the file is modified.
+func openPdf(filename string) (*os.File, *pdfReader, []pdfPage, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, err
+	}
+
+	doc, err := parsePdfDocument(filename, file, stat)
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, err
+	}
+
+	// reader of the opened file sharing parsed objects
+	reader := *doc.reader
+	reader.r = file
+	return file, &reader, doc.pages, nil
+}
+
+func parsePdfDocument(filename string, file *os.File, stat os.FileInfo) (*pdfDocument, error) {
+	pdfDocumentsLock.Lock()
+	defer pdfDocumentsLock.Unlock()
+
+	if doc, ok := pdfDocuments[filename]; ok && doc.modTime.Equal(stat.ModTime()) && doc.size == stat.Size() {
+		return doc, nil
+	}
+
+	reader, pages, err := readPdf(file, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	// reader does not keep the file
+	reader.r = nil
+	doc := &pdfDocument{reader, pages, stat.ModTime(), stat.Size()}
+
+	if _, ok := pdfDocuments[filename]; !ok {
+		pdfDocumentNames = append(pdfDocumentNames, filename)
+	}
+	pdfDocuments[filename] = doc
+	for len(pdfDocumentNames) > maxPdfDocuments {
+		delete(pdfDocuments, pdfDocumentNames[0])
+		pdfDocumentNames = pdfDocumentNames[1:]
+	}
+	return doc, nil
+}
+
+// Read cross-reference and pages of PDF
+func readPdf(r io.ReaderAt, size int64) (*pdfReader, []pdfPage, error) {
+	reader, err := newPdfReader(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	pages, err := reader.pages()
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, pages, nil
+}
+
+// List pages of PDF file. Pages without image are skipped, and Index is the page index in the file.
+func listPdfPages(filename string) ([]ImagePage, error) {
+	file, reader, pages, err := openPdf(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var result []ImagePage
+	for i, page := range pages {
+		if reader.pageImage(page) != nil {
+			result = append(result, ImagePage{filename, i, len(pages), ""})
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("PDF file has no image")
+	}
+	return result, nil
+}
+
+// Decode image of PDF page. Page is not rendered. Largest image of the page is extracted.
+func loadPdfPage(filename string, index int) (image.Image, error) {
+	file, reader, pages, err := openPdf(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if index < 0 || index >= len(pages) {
+		return nil, fmt.Errorf("PDF page out of range : %v", index + 1)
+	}
+	stream := reader.pageImage(pages[index])
+	if stream == nil {
+		return nil, fmt.Errorf("PDF page has no image : %v", index + 1)
+	}
+
+	img, err := reader.decodeImage(stream)
+	if err != nil {
+		return nil, err
+	}
+	return rotatePdfPage(img, pages[index].rotate), nil
+}
+
+// Resolution of page image from its width and page width
+func readPdfDpi(filename string, index int) float64 {
+	file, reader, pages, err := openPdf(filename)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	if index < 0 || index >= len(pages) {
+		return 0
+	}
+	stream := reader.pageImage(pages[index])
+	pageWidth := reader.pageWidth(pages[index])
+	if stream == nil || pageWidth <= 0 {
+		return 0
+	}
+	return float64(reader.int(stream.dict["Width"])) * 72 / pageWidth
+}
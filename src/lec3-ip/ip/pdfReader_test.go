@@ -0,0 +1,375 @@
+package ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPdfPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gray := createGrayImage(144, 72, 200)
+	filename := filepath.Join(dir, "scan.pdf")
+	w, err := NewPdfWriter(filename, PdfOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := []*BookPage{
+		encodeTestPage(t, CreateImage(60, 30, color.White), FormatJpeg, 300),
+		encodeTestPage(t, gray, FormatPng, 72),
+	}
+	for _, page := range pages {
+		if err := w.WritePage(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsImageFile(filename) {
+		t.Error("PDF file is not listed")
+	}
+
+	imagePages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imagePages) != 2 {
+		t.Fatalf("pages = %v", len(imagePages))
+	}
+	if name := imagePages[1].Name(); name != "scan_002.pdf" {
+		t.Errorf("name = %v", name)
+	}
+
+	img, err := imagePages[0].Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(60, 30) {
+		t.Errorf("page 1 size = %v", size)
+	}
+
+	img, err = imagePages[1].Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grayImg, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("page 2 is not gray : %T", img)
+	}
+	if !bytes.Equal(grayImg.Pix, gray.Pix) {
+		t.Error("page 2 pixels are changed")
+	}
+
+	if dpi := imagePages[0].Dpi(); dpi < 299 || dpi > 301 {
+		t.Errorf("page 1 dpi = %v", dpi)
+	}
+	if dpi := imagePages[1].Dpi(); dpi < 71 || dpi > 73 {
+		t.Errorf("page 2 dpi = %v", dpi)
+	}
+
+	single := ImagePage{filename, 0, 1, ""}
+	if name := single.Name(); name != "scan_001.pdf" {
+		t.Errorf("single page name = %v", name)
+	}
+}
+
+// Defects of malformed PDF. Empty value is valid.
+type testPdfDefect struct {
+	w         string // /W of cross-reference stream
+	objStm    string // /N and /First of object stream
+	recursive bool   // object stream is in itself
+}
+
+// Create PDF file with objects in compressed object stream, cross-reference stream with PNG predictor,
+// rotated page and 1 bit image with PNG predictor.
+func createTestCompressedPdf(t *testing.T, filename string) {
+	if err := ioutil.WriteFile(filename, buildTestCompressedPdf(t, testPdfDefect{}), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildTestCompressedPdf(t *testing.T, defect testPdfDefect) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+
+	// 16 x 2 bilevel image. first row is black, second row is white.
+	samples, err := deflate([]byte{2, 0x00, 0x00, 2, 0xff, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageOffset := buf.Len()
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Type /XObject /Subtype /Image /Width 16 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 1 "+
+		"/Filter [/FlateDecode] /DecodeParms [<< /Predictor 15 /Columns 16 /BitsPerComponent 1 >>] /Length %v >>\nstream\n", len(samples))
+	buf.Write(samples)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Rotate 90 /MediaBox [0 0 16 2] >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im#301 4 0 R >> >> >>",
+	}
+	var header, body bytes.Buffer
+	for i, object := range objects {
+		fmt.Fprintf(&header, "%v %v ", i + 1, body.Len())
+		body.WriteString(object + "\n")
+	}
+	objStm, err := deflate(append(header.Bytes(), body.Bytes()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defect.objStm == "" {
+		defect.objStm = fmt.Sprintf("/N %v /First %v", len(objects), header.Len())
+	}
+	objStmOffset := buf.Len()
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /ObjStm %v /Filter /FlateDecode /Length %v >>\nstream\n", defect.objStm, len(objStm))
+	buf.Write(objStm)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	// entries : type (1 byte), offset or object stream (4 bytes), index (2 bytes)
+	xrefOffset := buf.Len()
+	entries := [][3]int{{0, 0, 0}, {2, 5, 0}, {2, 5, 1}, {2, 5, 2}, {1, imageOffset, 0}, {1, objStmOffset, 0}, {1, xrefOffset, 0}}
+	if defect.recursive {
+		entries[5] = [3]int{2, 5, 3}
+	}
+	var rows []byte
+	prev := make([]byte, 7)
+	for _, entry := range entries {
+		row := make([]byte, 7)
+		row[0] = byte(entry[0])
+		binary.BigEndian.PutUint32(row[1:5], uint32(entry[1]))
+		binary.BigEndian.PutUint16(row[5:7], uint16(entry[2]))
+		// PNG up filter
+		rows = append(rows, 2)
+		for i := range row {
+			rows = append(rows, row[i] - prev[i])
+		}
+		prev = row
+	}
+	xref, err := deflate(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defect.w == "" {
+		defect.w = "[1 4 2]"
+	}
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Type /XRef /Size 7 /W %v /Root 1 0 R /Filter /FlateDecode "+
+		"/DecodeParms << /Predictor 12 /Columns 7 >> /Length %v >>\nstream\n", defect.w, len(xref))
+	buf.Write(xref)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%v\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func TestCompressedPdf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "scan.pdf")
+	createTestCompressedPdf(t, filename)
+
+	pages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("pages = %v", len(pages))
+	}
+
+	img, err := pages[0].Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("image is not gray : %T", img)
+	}
+	// rotated clockwise. black row is on the right.
+	if size := gray.Bounds().Size(); size != image.Pt(2, 16) {
+		t.Fatalf("size = %v", size)
+	}
+	for y := 0; y < 16; y++ {
+		if gray.GrayAt(0, y).Y != 255 || gray.GrayAt(1, y).Y != 0 {
+			t.Fatalf("row %v = %v, %v", y, gray.GrayAt(0, y), gray.GrayAt(1, y))
+		}
+	}
+
+	if dpi := pages[0].Dpi(); dpi != 72 {
+		t.Errorf("dpi = %v", dpi)
+	}
+}
+
+func TestPdfLexer(t *testing.T) {
+	data := []byte("<< /Name#20x (a\\(b\\)\\101) /Hex <41 4> /Array [1 0 R 2.5 true null] >>")
+	value, err := newPdfLexer(bytes.NewReader(data), 0, int64(len(data))).readValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict, ok := value.(pdfDict)
+	if !ok {
+		t.Fatalf("value = %v", value)
+	}
+
+	if s := dict["Name x"]; s != "a(b)A" {
+		t.Errorf("literal string = %q", s)
+	}
+	if s := dict["Hex"]; s != "A@" {
+		t.Errorf("hex string = %q", s)
+	}
+	array, ok := dict["Array"].(pdfArray)
+	if !ok {
+		t.Fatalf("dict = %v", dict)
+	}
+	expected := pdfArray{pdfRef{1, 0}, 2.5, true, nil}
+	if fmt.Sprint(array) != fmt.Sprint(expected) {
+		t.Errorf("array = %v", array)
+	}
+}
+
+// Read all page images of PDF data
+func readTestPdf(data []byte) error {
+	reader, pages, err := readPdf(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		stream := reader.pageImage(page)
+		if stream == nil {
+			return errors.New("no image")
+		}
+		if _, err := reader.decodeImage(stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMalformedPdf(t *testing.T) {
+	if err := readTestPdf(buildTestCompressedPdf(t, testPdfDefect{})); err != nil {
+		t.Fatalf("valid PDF failed : %v", err)
+	}
+
+	for _, defect := range []testPdfDefect{
+		{w: "[3 -1 2]"},
+		{w: "[1 9 2]"},
+		{w: "[1 4000 2]"},
+		{objStm: "/N -1 /First 10"},
+		{objStm: "/N 100000000000 /First 10"},
+		{objStm: "/N 3 /First -5"},
+		{objStm: "/N 3 /First 100000"},
+		{recursive: true},
+	} {
+		if err := readTestPdf(buildTestCompressedPdf(t, defect)); err == nil {
+			t.Errorf("expected error : %+v", defect)
+		}
+	}
+}
+
+// Corrupted PDF returns error, and does not panic
+func TestCorruptedPdf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "scan.pdf")
+	w, err := NewPdfWriter(filename, PdfOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePage(encodeTestPage(t, createGrayImage(16, 8, 200), FormatPng, 72)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for _, src := range [][]byte{data, buildTestCompressedPdf(t, testPdfDefect{})} {
+		for i := 0; i < 2000; i++ {
+			data := append([]byte{}, src...)
+			for j := random.Intn(4); j >= 0; j-- {
+				data[random.Intn(len(data))] = byte(random.Intn(256))
+			}
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("panic : %v\n%q", r, data)
+					}
+				}()
+				readTestPdf(data)
+			}()
+		}
+	}
+}
+
+func TestPdfDocumentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "scan.pdf")
+	createTestCompressedPdf(t, filename)
+
+	pages, err := ListPages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := pdfDocuments[filename]
+	if doc == nil {
+		t.Fatal("PDF is not cached")
+	}
+
+	// pages are loaded at the same time by workers
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := pages[0].Load()
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if pdfDocuments[filename] != doc {
+		t.Error("PDF is parsed again")
+	}
+
+	// modified file is parsed again
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pages[0].Load(); err != nil {
+		t.Fatal(err)
+	}
+	if pdfDocuments[filename] == doc {
+		t.Error("modified PDF is not parsed again")
+	}
+}
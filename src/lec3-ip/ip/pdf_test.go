@@ -0,0 +1,123 @@
+package ip
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func encodeTestPage(t *testing.T, img image.Image, format ImageFormat, dpi float64) *BookPage {
+	var buf bytes.Buffer
+	var err error
+	if format == FormatJpeg {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := img.Bounds()
+	return &BookPage{Format: format, Data: buf.Bytes(), Width: bounds.Dx(), Height: bounds.Dy(), Dpi: dpi}
+}
+
+func TestPdfWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	translucent := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	translucent.Set(0, 0, color.NRGBA{255, 0, 0, 128})
+
+	jpegPage := encodeTestPage(t, CreateImage(600, 300, color.White), FormatJpeg, 0)
+	pages := []*BookPage{
+		jpegPage,
+		encodeTestPage(t, image.NewGray(image.Rect(0, 0, 144, 72)), FormatPng, 72),
+		encodeTestPage(t, translucent, FormatPng, 0),
+	}
+
+	filename := filepath.Join(dir, "book.pdf")
+	w, err := NewPdfWriter(filename, PdfOption{Direction: "rtl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		if err := w.WritePage(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := string(data)
+
+	// jpeg is embedded without re-encoding
+	if !bytes.Contains(data, jpegPage.Data) {
+		t.Error("jpeg data is not embedded")
+	}
+	for _, s := range []string{
+		"%PDF-1.4",
+		"/Filter /DCTDecode",
+		"/ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+		"/SMask",
+		"/Count 3",
+		"/Direction /R2L",
+		"/Title (book)",
+	} {
+		if !strings.Contains(pdf, s) {
+			t.Errorf("pdf does not contain %v", s)
+		}
+	}
+
+	// 600x300 in default 300 dpi, and 144x72 in 72 dpi
+	if n := strings.Count(pdf, "/MediaBox [0 0 144.00 72.00]"); n != 2 {
+		t.Errorf("page size mismatch. expected=2 pages of 144x72, actual=%v", n)
+	}
+
+	// check offsets of cross-reference table
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindStringSubmatch(pdf)
+	if match == nil {
+		t.Fatal("startxref not found")
+	}
+	xrefOffset, _ := strconv.Atoi(match[1])
+	lines := strings.Split(pdf[xrefOffset:], "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("xref not found at %v", xrefOffset)
+	}
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for i := 1; i < count; i++ {
+		offset, _ := strconv.Atoi(strings.Fields(lines[2 + i])[0])
+		if prefix := strconv.Itoa(i) + " 0 obj"; !strings.HasPrefix(pdf[offset:], prefix) {
+			t.Errorf("invalid offset of object %v : %v", i, offset)
+		}
+	}
+}
+
+func TestPdfString(t *testing.T) {
+	for s, expected := range map[string]string{
+		"book (1)": `(book \(1\))`,
+		"a\\b":     `(a\\b)`,
+		"本 1":      "<FEFF672C00200031>",
+		"😀":        "<FEFFD83DDE00>",
+	} {
+		if actual := pdfString(s); actual != expected {
+			t.Errorf("pdf string mismatch. expected=%v, actual=%v", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package ip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"log"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// Pipeline
+// ----------------------------------------------------------------------------
+type pipelineFilter struct {
+	name   string
+	filter Filter
+}
+
+// Pipeline runs filters in order. Result image of each filter is passed to next filter.
+type Pipeline struct {
+	filters []pipelineFilter
+	output  OutputOption
+}
+
+// Create empty Pipeline instance
+func NewPipeline() *Pipeline {
+	return &Pipeline{output: DefaultOutputOption()}
+}
+
+// Set how result images are saved
+func (p *Pipeline) SetOutputOption(option OutputOption) *Pipeline {
+	p.output = option
+	return p
+}
+
+// How result images are saved
+func (p *Pipeline) OutputOption() OutputOption {
+	return p.output
+}
+
+// Append filter
+func (p *Pipeline) Add(name string, filter Filter) *Pipeline {
+	p.filters = append(p.filters, pipelineFilter{name, filter})
+	return p
+}
+
+// Append registered filter created with YAML options map
+func (p *Pipeline) AddNamed(name string, options map[string]interface{}) error {
+	filter, err := CreateFilter(name, options)
+	if err != nil {
+		return err
+	}
+	p.Add(name, filter)
+	return nil
+}
+
+// Number of filters
+func (p *Pipeline) Len() int {
+	return len(p.filters)
+}
+
+// Run filters on image. Returns *FilterError if any filter fails.
+// If image is split by filter, first image in output order is returned. Use ProcessImages to get all images.
+// Returned report is never nil and contains results of filters run so far.
+func (p *Pipeline) ProcessImage(ctx context.Context, src image.Image, filename string) (image.Image, *ImageReport, error) {
+	dests, report, err := p.ProcessImages(ctx, src, filename)
+	if err != nil {
+		return nil, report, err
+	}
+	return dests[0].Image, report, nil
+}
+
+// Run filters on image, and return result images in output order.
+// Single image without side is returned if image is not split.
+// Returned report is never nil and contains results of filters run so far.
+func (p *Pipeline) ProcessImages(ctx context.Context, src image.Image, filename string) ([]ImagePart, *ImageReport, error) {
+	report := NewImageReport(filename)
+	dests, err := p.processImage(ctx, src, filename, report)
+	report.setError(err)
+	return dests, report, err
+}
+
+func (p *Pipeline) processImage(ctx context.Context, src image.Image, filename string, report *ImageReport) ([]ImagePart, error) {
+	report.Input = newReportSize(src)
+	return p.runParts(ctx, []ImagePart{{Image: src, Scale: 1}}, filename, report)
+}
+
+// Run filters on each part, and set outputs to report
+func (p *Pipeline) runParts(ctx context.Context, parts []ImagePart, filename string, report *ImageReport) ([]ImagePart, error) {
+	start := time.Now()
+	defer func() {
+		report.Elapsed += elapsedMillis(start)
+	}()
+
+	var dests []ImagePart
+	for _, part := range parts {
+		partDests, err := p.runFilters(ctx, 0, part, filename, report)
+		if err != nil {
+			return nil, err
+		}
+		dests = append(dests, partDests...)
+	}
+
+	report.Output = newReportSize(dests[0].Image)
+	report.Parts = nil
+	if len(dests) > 1 {
+		for _, dest := range dests {
+			report.Parts = append(report.Parts, PartReport{Side: dest.Side, Output: newReportSize(dest.Image)})
+		}
+	}
+	return dests, nil
+}
+
+// Run filters from index i. Each part of split image is passed to next filters separately.
+// Split image is not split again.
+func (p *Pipeline) runFilters(ctx context.Context, i int, src ImagePart, filename string, report *ImageReport) ([]ImagePart, error) {
+	dest := src
+	for ; i < len(p.filters); i++ {
+		f := p.filters[i]
+		if err := ctx.Err(); err != nil {
+			return nil, &FilterError{f.name, err}
+		}
+
+		filterStart := time.Now()
+		result, err := f.filter.Run(ctx, NewFilterSource(dest.Image, filename))
+		if err == nil && (result == nil || result.Image() == nil) {
+			err = errors.New("result image is nil")
+		}
+		report.addFilter(f.name, dest.Side, result, elapsedMillis(filterStart), err)
+		if err != nil {
+			return nil, &FilterError{f.name, err}
+		}
+		result.Log()
+
+		if splitResult, ok := result.(SplitResult); ok && dest.Side == "" && len(splitResult.Parts()) > 0 {
+			var dests []ImagePart
+			for _, part := range splitResult.Parts() {
+				if part.Image == nil {
+					return nil, &FilterError{f.name, errors.New("split image is nil")}
+				}
+				part.Scale = dest.Scale
+				partDests, err := p.runFilters(ctx, i + 1, part, filename, report)
+				if err != nil {
+					return nil, err
+				}
+				dests = append(dests, partDests...)
+			}
+			return dests, nil
+		}
+
+		dest.Image = result.Image()
+		if scaledResult, ok := result.(ScaledResult); ok {
+			dest.Scale *= scaledResult.Scale()
+		}
+	}
+	return []ImagePart{dest}, nil
+}
+
+// Load image file, run filters and save result to destDir in output format.
+// Existing file is handled according to overwrite policy of output option.
+// Returned report is never nil.
+func (p *Pipeline) ProcessFile(ctx context.Context, srcFilename string, destDir string) (*ImageReport, error) {
+	return p.ProcessPage(ctx, NewImagePage(srcFilename), destDir)
+}
+
+// Load page of image file, run filters and save result to destDir in output format.
+// Pages of archive are saved to subdirectory of destDir named after the archive.
+// Side is added to names of split images. ex) page1_L.jpg
+// Returned report is never nil.
+func (p *Pipeline) ProcessPage(ctx context.Context, page ImagePage, destDir string) (*ImageReport, error) {
+	images, report, err := LoadPageImages(page)
+	if err != nil {
+		return report, err
+	}
+	return p.ProcessPageImages(ctx, images, destDir)
+}
+
+// Load page of image file, run filters and save result to slash separated name relative to destDir.
+// nameOf returns name of image of side. side is empty if image is not split.
+// Image is encoded in output format regardless of extension of name.
+// Returned report is never nil.
+func (p *Pipeline) ProcessPageAs(ctx context.Context, page ImagePage, destDir string, nameOf func(side string) string) (*ImageReport, error) {
+	images, report, err := LoadPageImages(page)
+	if err != nil {
+		return report, err
+	}
+	return p.ProcessPageImagesAs(ctx, images, destDir, nameOf)
+}
+
+// Load page of image file, run filters and encode results in output format to be written to book.
+// Split images are returned in output order.
+// Returned report is never nil.
+func (p *Pipeline) EncodePages(ctx context.Context, page ImagePage) ([]*BookPage, *ImageReport, error) {
+	images, report, err := LoadPageImages(page)
+	if err != nil {
+		return nil, report, err
+	}
+	return p.EncodePageImages(ctx, images)
+}
+
+// Load image file and run filters without saving result.
+// Returned report is never nil.
+func (p *Pipeline) AnalyzeFile(ctx context.Context, srcFilename string) (*ImageReport, error) {
+	return p.AnalyzePage(ctx, NewImagePage(srcFilename))
+}
+
+// Load page of image file and run filters without saving result.
+// Returned report is never nil.
+func (p *Pipeline) AnalyzePage(ctx context.Context, page ImagePage) (*ImageReport, error) {
+	images, report, err := LoadPageImages(page)
+	if err != nil {
+		return report, err
+	}
+	return p.AnalyzePageImages(ctx, images)
+}
+
+// ----------------------------------------------------------------------------
+// Page images
+// ----------------------------------------------------------------------------
+
+// Images of page processed by pipelines. Result images of a pipeline can be processed by other pipelines (branches),
+// so that source is decoded and shared filters are run only once.
+type PageImages struct {
+	Page   ImagePage
+	Parts  []ImagePart   // images in output order
+	report *ImageReport // report of processing so far
+}
+
+// Load page of image file to be processed by pipelines.
+// Returned report is never nil.
+func LoadPageImages(page ImagePage) (*PageImages, *ImageReport, error) {
+	report := newPageReport(page)
+	log.Printf("[R] %v\n", page.Name())
+
+	src, err := page.Load()
+	if err != nil {
+		report.setError(err)
+		return nil, report, err
+	}
+
+	report.Input = newReportSize(src)
+	report.Output = report.Input
+	return &PageImages{page, []ImagePart{{Image: src, Scale: 1}}, report}, report, nil
+}
+
+// Run filters on images, and return result images to be processed by branch pipelines.
+// images are not changed. Returned report is never nil.
+func (p *Pipeline) RunPageImages(ctx context.Context, images *PageImages) (*PageImages, *ImageReport, error) {
+	report := images.report.copy()
+	dests, err := p.runParts(ctx, images.Parts, images.Page.Name(), report)
+	report.setError(err)
+	if err != nil {
+		return nil, report, err
+	}
+	return &PageImages{images.Page, dests, report}, report, nil
+}
+
+// Run filters on images and save result to destDir in output format. Same as ProcessPage except that page is already loaded.
+// Returned report is never nil.
+func (p *Pipeline) ProcessPageImages(ctx context.Context, images *PageImages, destDir string) (*ImageReport, error) {
+	name := path.Join(images.Page.Dir(), p.output.Filename(images.Page.Name()))
+	return p.ProcessPageImagesAs(ctx, images, destDir, func(side string) string {
+		return SideName(name, side)
+	})
+}
+
+// Run filters on images and save result to name relative to destDir. Same as ProcessPageAs except that page is already loaded.
+// Returned report is never nil.
+func (p *Pipeline) ProcessPageImagesAs(ctx context.Context, images *PageImages, destDir string, nameOf func(side string) string) (*ImageReport, error) {
+	report := images.report.copy()
+	err := p.processPage(ctx, images, func(side string) (string, error) {
+		filename := filepath.Join(destDir, filepath.FromSlash(nameOf(side)))
+		if !IsInDir(filename, destDir) {
+			return "", errors.New("Dest file is outside of dest directory : " + filename)
+		}
+		return filename, nil
+	}, report)
+	report.setError(err)
+	return report, err
+}
+
+func (p *Pipeline) processPage(ctx context.Context, images *PageImages, filenameOf func(side string) (string, error), report *ImageReport) error {
+	name := images.Page.Name()
+	dests, err := p.runParts(ctx, images.Parts, name, report)
+	if err != nil {
+		return err
+	}
+
+	for i, dest := range dests {
+		filename, err := filenameOf(dest.Side)
+		if err != nil {
+			return err
+		}
+		destFilename, err := saveImageAs(dest.Image, filename, name, p.output)
+		if err != nil {
+			return err
+		}
+
+		skipped := destFilename == ""
+		if skipped {
+			log.Printf("[SKIP] %v : dest file exists\n", SideName(name, dest.Side))
+			destFilename = filename
+		}
+		if i == 0 {
+			report.Dest = destFilename
+			report.Skipped = skipped
+		}
+		if i < len(report.Parts) {
+			report.Parts[i].Dest = destFilename
+			report.Parts[i].Skipped = skipped
+		}
+	}
+	return nil
+}
+
+// Run filters on images and encode results to be written to book. Same as EncodePages except that page is already loaded.
+// Returned report is never nil.
+func (p *Pipeline) EncodePageImages(ctx context.Context, images *PageImages) ([]*BookPage, *ImageReport, error) {
+	report := images.report.copy()
+	bookPages, err := p.encodePages(ctx, images, report)
+	report.setError(err)
+	return bookPages, report, err
+}
+
+func (p *Pipeline) encodePages(ctx context.Context, images *PageImages, report *ImageReport) ([]*BookPage, error) {
+	filename := images.Page.Name()
+	dests, err := p.runParts(ctx, images.Parts, filename, report)
+	if err != nil {
+		return nil, err
+	}
+
+	var bookPages []*BookPage
+	for _, dest := range dests {
+		var buf bytes.Buffer
+		if err := p.output.Encode(&buf, dest.Image, filename); err != nil {
+			return nil, err
+		}
+
+		bounds := dest.Image.Bounds()
+		bookPages = append(bookPages, &BookPage{
+			Name:   SideName(p.output.Filename(filename), dest.Side),
+			Format: p.output.FormatOf(filename),
+			Data:   buf.Bytes(),
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+			Dpi:    images.Page.Dpi() * dest.Scale,
+			Side:   dest.Side,
+		})
+	}
+	return bookPages, nil
+}
+
+// Run filters on images without saving result. Same as AnalyzePage except that page is already loaded.
+// Returned report is never nil.
+func (p *Pipeline) AnalyzePageImages(ctx context.Context, images *PageImages) (*ImageReport, error) {
+	report := images.report.copy()
+	_, err := p.runParts(ctx, images.Parts, images.Page.Name(), report)
+	report.setError(err)
+	return report, err
+}
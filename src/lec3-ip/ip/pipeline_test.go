@@ -0,0 +1,207 @@
+package ip
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type nilResult struct{}
+
+func (r nilResult) Image() image.Image {
+	return nil
+}
+
+func (r nilResult) Log() {
+}
+
+type nilFilter struct{}
+
+func (f nilFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	return nilResult{}, nil
+}
+
+func newTestPipeline(t *testing.T) *Pipeline {
+	pipeline := NewPipeline()
+	err := pipeline.AddNamed("autoCrop", map[string]interface{}{
+		"threshold": 128,
+		"minRatio":  1.0, "maxRatio": 3.0,
+		"maxWidthCropRate": 0.5, "maxHeightCropRate": 0.5,
+	})
+	if err != nil {
+		t.Fatalf("AddNamed failed : %v", err)
+	}
+	return pipeline
+}
+
+func TestPipelineProcessImage(t *testing.T) {
+	img := CreateImage(200, 350, color.White)
+	FillRect(img, 50, 50, 150, 300, color.Black)
+
+	dest, report, err := newTestPipeline(t).ProcessImage(context.Background(), img, "filename")
+	if err != nil {
+		t.Fatalf("ProcessImage failed : %v", err)
+	}
+	if bounds := dest.Bounds(); bounds.Dx() >= 200 || bounds.Dy() >= 350 {
+		t.Errorf("image not cropped : %v", bounds)
+	}
+
+	// report
+	if report.Input.Width != 200 || report.Input.Height != 350 {
+		t.Errorf("input size mismatch : %v", report.Input)
+	}
+	if report.Output.Width != dest.Bounds().Dx() || report.Output.Height != dest.Bounds().Dy() {
+		t.Errorf("output size mismatch : %v", report.Output)
+	}
+	if len(report.Filters) != 1 || report.Filters[0].Name != "autoCrop" {
+		t.Errorf("filter report mismatch : %v", report.Filters)
+	}
+	if report.Crop == nil || report.Crop.Right-report.Crop.Left != dest.Bounds().Dx() {
+		t.Errorf("crop rect mismatch : %v", report.Crop)
+	}
+}
+
+func TestPipelineNilResult(t *testing.T) {
+	pipeline := NewPipeline().Add("nil", nilFilter{})
+	_, report, err := pipeline.ProcessImage(context.Background(), CreateImage(10, 10, color.White), "filename")
+	if err == nil {
+		t.Errorf("expected error for nil result")
+	}
+	if report.Error == "" || len(report.Filters) != 1 || report.Filters[0].Error == "" {
+		t.Errorf("error not reported : %v", report)
+	}
+}
+
+func TestPipelineProcessFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := CreateImage(200, 350, color.White)
+	FillRect(img, 50, 50, 150, 300, color.Black)
+	if err := SaveJpeg(img, dir, "src.jpg", 90); err != nil {
+		t.Fatal(err)
+	}
+
+	destDir := filepath.Join(dir, "output")
+	if _, err := newTestPipeline(t).ProcessFile(context.Background(), filepath.Join(dir, "src.jpg"), destDir); err != nil {
+		t.Fatalf("ProcessFile failed : %v", err)
+	}
+
+	dest, err := LoadImage(filepath.Join(destDir, "src.jpg"))
+	if err != nil {
+		t.Fatalf("failed to load result : %v", err)
+	}
+	if bounds := dest.Bounds(); bounds.Dx() >= 200 || bounds.Dy() >= 350 {
+		t.Errorf("image not cropped : %v", bounds)
+	}
+}
+
+func TestPipelineAnalyzeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := CreateImage(200, 350, color.White)
+	FillRect(img, 50, 50, 150, 300, color.Black)
+	if err := SaveJpeg(img, dir, "src.jpg", 90); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := newTestPipeline(t).AnalyzeFile(context.Background(), filepath.Join(dir, "src.jpg"))
+	if err != nil {
+		t.Fatalf("AnalyzeFile failed : %v", err)
+	}
+	if report.Dest != "" || report.Crop == nil {
+		t.Errorf("unexpected report : %v", report)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("files written on analyze : %v", len(files))
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	pipeline := NewPipeline().Add("deskew", NewDeskewFilter(DeskewOption{
+		MaxRotation: 2,
+		IncrStep:    0.2,
+		Threshold:   220,
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewDeskewFilter(DeskewOption{IncrStep: 0.2, MaxRotation: 2}).Run(ctx, NewFilterSource(CreateImage(100, 100, color.White), "filename")); err != context.Canceled {
+		t.Errorf("deskew not cancelled : %v", err)
+	}
+
+	_, _, err := pipeline.ProcessImage(ctx, CreateImage(100, 100, color.White), "filename")
+	filterErr, ok := err.(*FilterError)
+	if !ok {
+		t.Fatalf("expected FilterError. actual=%v", err)
+	}
+	if filterErr.Filter != "deskew" || filterErr.Err != context.Canceled {
+		t.Errorf("unexpected error : %v", filterErr)
+	}
+}
+
+func TestPipelineBranch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := CreateImage(200, 350, color.White)
+	FillRect(img, 50, 50, 150, 300, color.Black)
+	if err := SaveJpeg(img, dir, "src.jpg", 90); err != nil {
+		t.Fatal(err)
+	}
+
+	// shared filters are run once, and each branch continues from the result
+	images, _, err := LoadPageImages(NewImagePage(filepath.Join(dir, "src.jpg")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, _, err = newTestPipeline(t).RunPageImages(context.Background(), images)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := NewPipeline().SetOutputOption(OutputOption{Format: FormatPng})
+	report, err := archive.ProcessPageImages(context.Background(), images, filepath.Join(dir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Crop == nil || len(report.Filters) != 1 {
+		t.Errorf("shared filter is not reported : %v", report.Filters)
+	}
+
+	device := NewPipeline().Add("deskew", NewDeskewFilter(DeskewOption{IncrStep: 0.2, MaxRotation: 2, Threshold: 220}))
+	report, err = device.ProcessPageImages(context.Background(), images, filepath.Join(dir, "device"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Filters) != 2 || report.Filters[1].Name != "deskew" {
+		t.Errorf("branch filter is not reported : %v", report.Filters)
+	}
+
+	for _, filename := range []string{"archive/src.png", "device/src.jpg"} {
+		dest, err := LoadImage(filepath.Join(dir, filepath.FromSlash(filename)))
+		if err != nil {
+			t.Fatalf("failed to load result : %v", err)
+		}
+		if bounds := dest.Bounds(); bounds.Dx() >= 200 || bounds.Dy() >= 350 {
+			t.Errorf("%v not cropped : %v", filename, bounds)
+		}
+	}
+}
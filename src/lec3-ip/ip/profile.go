@@ -0,0 +1,162 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/disintegration/gift"
+	"github.com/mitchellh/mapstructure"
+	"image"
+	"sort"
+	"sync"
+)
+
+// ----------------------------------------------------------------------------
+// Device profile
+// ----------------------------------------------------------------------------
+
+// Screen and output settings of e-reader device
+type DeviceProfile struct {
+	Name      string
+	Width     int         // screen width in pixels
+	Height    int         // screen height in pixels
+	Mode      string      // resize mode. fit, fill, stretch. default: fit
+	Upscale   bool        // enlarge page smaller than screen
+	Grayscale bool        // convert to grayscale for e-ink screen
+	Gamma     float32     // gamma correction. less than 1 darkens, greater than 1 lightens. 0 or 1 keeps image
+	Format    ImageFormat // output format. empty keeps dest format
+}
+
+var deviceProfiles = make(map[string]DeviceProfile)
+var deviceProfilesLock sync.RWMutex
+
+func init() {
+	for _, profile := range []DeviceProfile{
+		{Name: "kindle", Width: 600, Height: 800, Grayscale: true, Format: FormatJpeg},
+		{Name: "kindlePaperwhite", Width: 1072, Height: 1448, Grayscale: true, Format: FormatJpeg},
+		{Name: "kindlePaperwhite5", Width: 1236, Height: 1648, Grayscale: true, Format: FormatJpeg},
+		{Name: "kindleOasis", Width: 1264, Height: 1680, Grayscale: true, Format: FormatJpeg},
+		{Name: "kindleScribe", Width: 1860, Height: 2480, Grayscale: true, Format: FormatJpeg},
+		{Name: "koboClara", Width: 1072, Height: 1448, Grayscale: true, Format: FormatJpeg},
+		{Name: "koboClaraColour", Width: 1072, Height: 1448, Format: FormatJpeg},
+		{Name: "koboLibra", Width: 1264, Height: 1680, Grayscale: true, Format: FormatJpeg},
+		{Name: "koboSage", Width: 1440, Height: 1920, Grayscale: true, Format: FormatJpeg},
+		{Name: "koboElipsa", Width: 1404, Height: 1872, Grayscale: true, Format: FormatJpeg},
+	} {
+		RegisterDeviceProfile(profile)
+	}
+}
+
+// Register device profile. Profile of same name is replaced.
+func RegisterDeviceProfile(profile DeviceProfile) {
+	deviceProfilesLock.Lock()
+	defer deviceProfilesLock.Unlock()
+
+	deviceProfiles[profile.Name] = profile
+}
+
+// Find device profile by name
+func LookupDeviceProfile(name string) (DeviceProfile, bool) {
+	deviceProfilesLock.RLock()
+	defer deviceProfilesLock.RUnlock()
+
+	profile, ok := deviceProfiles[name]
+	return profile, ok
+}
+
+// List device profiles sorted by name
+func DeviceProfiles() []DeviceProfile {
+	deviceProfilesLock.RLock()
+	defer deviceProfilesLock.RUnlock()
+
+	var names []string
+	for name := range deviceProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []DeviceProfile
+	for _, name := range names {
+		result = append(result, deviceProfiles[name])
+	}
+	return result
+}
+
+// Decode device profile from YAML map. Settings not in m are taken from registered profile of same name.
+func DecodeDeviceProfile(name string, m map[string]interface{}) (DeviceProfile, error) {
+	profile, _ := LookupDeviceProfile(name)
+	if err := mapstructure.Decode(m, &profile); err != nil {
+		return profile, err
+	}
+	profile.Name = name
+
+	if profile.Format != "" {
+		format, err := ParseImageFormat(string(profile.Format))
+		if err != nil {
+			return profile, err
+		}
+		profile.Format = format
+	}
+	if profile.Gamma < 0 {
+		return profile, errors.New("Gamma should not be negative : " + name)
+	}
+	if err := profile.resizeOption().validate(); err != nil {
+		return profile, fmt.Errorf("%v : %v", name, err)
+	}
+	return profile, nil
+}
+
+func (d DeviceProfile) resizeOption() ResizeOption {
+	return ResizeOption{Width: d.Width, Height: d.Height, Mode: d.Mode, Upscale: d.Upscale}
+}
+
+// Add filters converting pages for device : resize, grayscale and gamma
+func (d DeviceProfile) AddFilters(p *Pipeline) *Pipeline {
+	p.Add("resize", NewResizeFilter(d.resizeOption()))
+	if d.Grayscale {
+		p.Add("grayscale", NewGrayscaleFilter(GrayscaleOption{}))
+	}
+	if d.Gamma > 0 && d.Gamma != 1 {
+		p.Add("gamma", giftFilter{gift.New(gift.Gamma(d.Gamma))})
+	}
+	return p
+}
+
+// Print device profiles
+func PrintDeviceProfiles() {
+	for _, d := range DeviceProfiles() {
+		color := "color"
+		if d.Grayscale {
+			color = "gray"
+		}
+		fmt.Printf("%-22v %vx%v %v %v\n", d.Name, d.Width, d.Height, color, d.Format)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Gift filter
+// ----------------------------------------------------------------------------
+
+// Filter running gift filters
+type giftFilter struct {
+	g *gift.GIFT
+}
+
+type giftResult struct {
+	image image.Image
+}
+
+func (r giftResult) Image() image.Image {
+	return r.image
+}
+
+func (r giftResult) Log() {
+}
+
+// Implements Filter.Run()
+func (f giftFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return giftResult{applyGift(f.g, s.Image)}, nil
+}
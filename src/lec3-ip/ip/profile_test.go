@@ -0,0 +1,58 @@
+package ip
+
+import (
+	"context"
+	"image/color"
+	"testing"
+)
+
+func TestDecodeDeviceProfile(t *testing.T) {
+	// settings of registered profile are kept
+	profile, err := DecodeDeviceProfile("kindlePaperwhite", map[string]interface{}{"mode": "fill", "gamma": 1.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Width != 1072 || profile.Height != 1448 || !profile.Grayscale || profile.Mode != ResizeFill || profile.Gamma != 1.8 {
+		t.Errorf("profile mismatch : %v", profile)
+	}
+
+	profile, err = DecodeDeviceProfile("tablet", map[string]interface{}{"width": 1200, "height": 1600, "format": "png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "tablet" || profile.Format != FormatPng || profile.Grayscale {
+		t.Errorf("profile mismatch : %v", profile)
+	}
+
+	if _, err := DecodeDeviceProfile("broken", map[string]interface{}{"format": "bmp"}); err == nil {
+		t.Error("expected error of unknown format")
+	}
+	if _, err := DecodeDeviceProfile("broken", map[string]interface{}{}); err == nil {
+		t.Error("expected error of missing size")
+	}
+}
+
+func TestDeviceProfileFilters(t *testing.T) {
+	profile, ok := LookupDeviceProfile("kindle")
+	if !ok {
+		t.Fatal("kindle profile is not registered")
+	}
+	profile.Gamma = 1.5
+
+	pipeline := profile.AddFilters(NewPipeline())
+	if pipeline.Len() != 3 {
+		t.Errorf("filter count mismatch : %v", pipeline.Len())
+	}
+
+	img := CreateImage(1200, 1600, color.RGBA{200, 0, 0, 255})
+	dest, _, err := pipeline.ProcessImage(context.Background(), img, "filename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := dest.Bounds(); bounds.Dx() != 600 || bounds.Dy() != 800 {
+		t.Errorf("size mismatch : %v", bounds)
+	}
+	if r, g, b, _ := dest.At(300, 400).RGBA(); r != g || g != b {
+		t.Errorf("page is not gray : %v, %v, %v", r, g, b)
+	}
+}
@@ -0,0 +1,147 @@
+package ip
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ----------------------------------------------------------------------------
+// Filter registration
+// ----------------------------------------------------------------------------
+
+// Decode filter option from YAML options map
+type FilterOptionDecoder func(m map[string]interface{}) (interface{}, error)
+
+// Create filter from decoded option
+type FilterConstructor func(option interface{}) Filter
+
+type FilterRegistration struct {
+	Name         string
+	Option       interface{} // zero option value. used to describe option schema
+	DecodeOption FilterOptionDecoder
+	NewFilter    FilterConstructor
+}
+
+type FilterOptionField struct {
+	Name string
+	Type string
+}
+
+// List option fields. Field names are returned as used in YAML.
+func (r FilterRegistration) Schema() []FilterOptionField {
+	var fields []FilterOptionField
+
+	t := reflect.TypeOf(r.Option)
+	if t == nil {
+		return fields
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, FilterOptionField{lowerFirst(field.Name), field.Type.String()})
+	}
+	return fields
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+// ----------------------------------------------------------------------------
+// Filter registry
+// ----------------------------------------------------------------------------
+var (
+	filterRegistryLock sync.RWMutex
+	filterRegistry     = make(map[string]FilterRegistration)
+)
+
+// Register filter. Panics if name is empty or already registered.
+func RegisterFilter(r FilterRegistration) {
+	filterRegistryLock.Lock()
+	defer filterRegistryLock.Unlock()
+
+	if r.Name == "" {
+		panic("RegisterFilter : filter name is empty")
+	}
+	if r.DecodeOption == nil || r.NewFilter == nil {
+		panic("RegisterFilter : decoder or constructor is nil : " + r.Name)
+	}
+	if _, dup := filterRegistry[r.Name]; dup {
+		panic("RegisterFilter : filter registered twice : " + r.Name)
+	}
+	filterRegistry[r.Name] = r
+}
+
+// Find registered filter by name
+func LookupFilter(name string) (FilterRegistration, bool) {
+	filterRegistryLock.RLock()
+	defer filterRegistryLock.RUnlock()
+
+	r, ok := filterRegistry[name]
+	return r, ok
+}
+
+// List registered filters sorted by name
+func RegisteredFilters() []FilterRegistration {
+	filterRegistryLock.RLock()
+	defer filterRegistryLock.RUnlock()
+
+	var names []string
+	for name := range filterRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []FilterRegistration
+	for _, name := range names {
+		result = append(result, filterRegistry[name])
+	}
+	return result
+}
+
+// Create filter instance with registered filter name and YAML options map
+func CreateFilter(name string, options map[string]interface{}) (Filter, error) {
+	r, ok := LookupFilter(name)
+	if !ok {
+		return nil, errors.New("Unknown filter name : " + name)
+	}
+
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	option, err := r.DecodeOption(options)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := r.NewFilter(option)
+	if filter == nil {
+		return nil, fmt.Errorf("Failed to create filter : %v", name)
+	}
+	return filter, nil
+}
+
+// Print registered filters and their option schema
+func PrintFilters() {
+	for _, r := range RegisteredFilters() {
+		fmt.Println(r.Name)
+		for _, field := range r.Schema() {
+			fmt.Printf("  %-22v %v\n", field.Name, field.Type)
+		}
+	}
+}
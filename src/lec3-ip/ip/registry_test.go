@@ -0,0 +1,89 @@
+package ip
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+type testFilterOption struct {
+	Level int
+}
+
+type testFilter struct {
+	option testFilterOption
+}
+
+func (f testFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	return AutoCropResult{s.Image, s.Image.Bounds()}, nil
+}
+
+func TestRegisteredBuiltinFilters(t *testing.T) {
+	for _, name := range []string{"deskew", "deskewED", "autoCrop", "autoCropED", "split", "resize", "grayscale", "levels", "binarize"} {
+		if _, ok := LookupFilter(name); !ok {
+			t.Errorf("filter not registered : %v", name)
+		}
+	}
+}
+
+func registerTestFilter() {
+	RegisterFilter(FilterRegistration{
+		Name:   "testRegistry",
+		Option: testFilterOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			option := testFilterOption{}
+			if level, ok := m["level"].(int); ok {
+				option.Level = level
+			}
+			return &option, nil
+		},
+		NewFilter: func(option interface{}) Filter {
+			return testFilter{*option.(*testFilterOption)}
+		},
+	})
+}
+
+func TestRegisterFilter(t *testing.T) {
+	// registry is global. filter registered in previous run of test (-count) is kept
+	if _, ok := LookupFilter("testRegistry"); !ok {
+		registerTestFilter()
+	}
+
+	filter, err := CreateFilter("testRegistry", map[string]interface{}{"level": 3})
+	if err != nil {
+		t.Fatalf("CreateFilter failed : %v", err)
+	}
+	if level := filter.(testFilter).option.Level; level != 3 {
+		t.Errorf("level mismatch. expected=3, actual=%v", level)
+	}
+
+	result, err := filter.Run(context.Background(), NewFilterSource(image.NewGray(image.Rect(0, 0, 2, 2)), "filename"))
+	if err != nil {
+		t.Fatalf("Run failed : %v", err)
+	}
+	if result.Image() == nil {
+		t.Errorf("result image is nil")
+	}
+}
+
+func TestCreateFilterErrors(t *testing.T) {
+	if _, err := CreateFilter("unknown", nil); err == nil {
+		t.Errorf("expected error for unknown filter")
+	}
+	if _, err := CreateFilter("deskew", map[string]interface{}{"maxRotation": "abc"}); err == nil {
+		t.Errorf("expected error for invalid option")
+	}
+}
+
+func TestFilterSchema(t *testing.T) {
+	r, _ := LookupFilter("deskew")
+	found := false
+	for _, field := range r.Schema() {
+		if field.Name == "maxRotation" && field.Type == "float32" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("maxRotation not found in schema : %v", r.Schema())
+	}
+}
@@ -0,0 +1,199 @@
+package ip
+
+import (
+	"encoding/json"
+	"image"
+	"io"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// Image report
+// ----------------------------------------------------------------------------
+type ReportSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type ReportRect struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Right  int `json:"right"`
+	Bottom int `json:"bottom"`
+}
+
+type FilterReport struct {
+	Name     string      `json:"name"`
+	Side     string      `json:"side,omitempty"` // side of split page the filter is run on
+	Elapsed  float64     `json:"elapsedMs"`
+	Rotation *float32    `json:"rotation,omitempty"`
+	Crop     *ReportRect `json:"crop,omitempty"`
+	Split    int         `json:"split,omitempty"` // number of split images
+	Error    string      `json:"error,omitempty"`
+}
+
+// Output of split page
+type PartReport struct {
+	Side    string      `json:"side"`
+	Dest    string      `json:"dest,omitempty"`
+	Skipped bool        `json:"skipped,omitempty"`
+	Output  *ReportSize `json:"output,omitempty"`
+}
+
+// Processing result of single image
+type ImageReport struct {
+	Src      string         `json:"src"`
+	Branch   string         `json:"branch,omitempty"` // name of pipeline branch writing dest
+	Page     int            `json:"page,omitempty"`   // page number of multi-page source file
+	Entry    string         `json:"entry,omitempty"`  // image entry path in archive
+	Dest     string         `json:"dest,omitempty"`
+	Skipped  bool           `json:"skipped,omitempty"` // dest file exists and is not overwritten
+	Input    *ReportSize    `json:"input,omitempty"`
+	Output   *ReportSize    `json:"output,omitempty"`
+	Rotation float32        `json:"rotation"`
+	Crop     *ReportRect    `json:"crop,omitempty"`
+	Filters  []FilterReport `json:"filters"`
+	Parts    []PartReport   `json:"parts,omitempty"` // outputs of split page in output order
+	Elapsed  float64        `json:"elapsedMs"`
+	Error    string         `json:"error,omitempty"`
+	side     string         // side of first split image. rotation, crop, dest and output are of this side
+}
+
+func NewImageReport(src string) *ImageReport {
+	return &ImageReport{Src: src, Filters: []FilterReport{}}
+}
+
+func newPageReport(page ImagePage) *ImageReport {
+	report := NewImageReport(page.Filename)
+	if page.IsMultiPage() {
+		report.Page = page.Index + 1
+	}
+	report.Entry = page.Entry
+	return report
+}
+
+func newReportSize(img image.Image) *ReportSize {
+	bounds := img.Bounds()
+	return &ReportSize{bounds.Dx(), bounds.Dy()}
+}
+
+func newReportRect(rect image.Rectangle) *ReportRect {
+	return &ReportRect{rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y}
+}
+
+func elapsedMillis(start time.Time) float64 {
+	return float64(time.Since(start).Nanoseconds()) / float64(time.Millisecond)
+}
+
+// Add filter result to report. side is side of split image the filter is run on.
+func (r *ImageReport) addFilter(name string, side string, result FilterResult, elapsed float64, err error) {
+	filterReport := FilterReport{Name: name, Side: side, Elapsed: elapsed}
+	if err != nil {
+		filterReport.Error = err.Error()
+	}
+
+	// parts are run in output order
+	if r.side == "" {
+		r.side = side
+	}
+	first := side == r.side
+
+	if rotateResult, ok := result.(RotateResult); ok {
+		angle := rotateResult.RotatedAngle()
+		filterReport.Rotation = &angle
+		if first {
+			r.Rotation += angle
+		}
+	}
+	if cropResult, ok := result.(CropResult); ok {
+		filterReport.Crop = newReportRect(cropResult.CropRect())
+		if first {
+			r.Crop = filterReport.Crop
+		}
+	}
+	if splitResult, ok := result.(SplitResult); ok && len(splitResult.Parts()) > 1 {
+		filterReport.Split = len(splitResult.Parts())
+	}
+
+	r.Filters = append(r.Filters, filterReport)
+}
+
+// Copy of report to be continued by other pipeline
+func (r *ImageReport) copy() *ImageReport {
+	c := *r
+	c.Filters = append([]FilterReport{}, r.Filters...)
+	c.Parts = append([]PartReport(nil), r.Parts...)
+	return &c
+}
+
+func (r *ImageReport) setError(err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Report writer
+// ----------------------------------------------------------------------------
+
+// ReportWriter writes image reports as JSON Lines, or as single JSON array if jsonArray is true.
+// Safe for concurrent use.
+type ReportWriter struct {
+	w         io.Writer
+	jsonArray bool
+	count     int
+	lock      sync.Mutex
+}
+
+func NewReportWriter(w io.Writer, jsonArray bool) *ReportWriter {
+	return &ReportWriter{w: w, jsonArray: jsonArray}
+}
+
+// Write single image report
+func (rw *ReportWriter) Write(r *ImageReport) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	prefix := ""
+	if rw.jsonArray {
+		if rw.count == 0 {
+			prefix = "[\n"
+		} else {
+			prefix = ",\n"
+		}
+	}
+	rw.count++
+
+	if _, err = io.WriteString(rw.w, prefix); err != nil {
+		return err
+	}
+	if _, err = rw.w.Write(data); err != nil {
+		return err
+	}
+	if !rw.jsonArray {
+		_, err = io.WriteString(rw.w, "\n")
+	}
+	return err
+}
+
+// Finish report. Closes JSON array if jsonArray is true.
+func (rw *ReportWriter) Close() error {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+
+	if !rw.jsonArray {
+		return nil
+	}
+	if rw.count == 0 {
+		_, err := io.WriteString(rw.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(rw.w, "\n]\n")
+	return err
+}
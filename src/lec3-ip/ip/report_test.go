@@ -0,0 +1,47 @@
+package ip
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReportWriterJsonLines(t *testing.T) {
+	buf := &bytes.Buffer{}
+	rw := NewReportWriter(buf, false)
+	rw.Write(NewImageReport("a.jpg"))
+	rw.Write(NewImageReport("b.jpg"))
+	rw.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("line count mismatch. expected=2, actual=%v", len(lines))
+	}
+	report := ImageReport{}
+	if err := json.Unmarshal([]byte(lines[1]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Src != "b.jpg" {
+		t.Errorf("src mismatch. expected=b.jpg, actual=%v", report.Src)
+	}
+}
+
+func TestReportWriterJsonArray(t *testing.T) {
+	for _, count := range []int{0, 1, 3} {
+		buf := &bytes.Buffer{}
+		rw := NewReportWriter(buf, true)
+		for i := 0; i < count; i++ {
+			rw.Write(NewImageReport("a.jpg"))
+		}
+		rw.Close()
+
+		var reports []ImageReport
+		if err := json.Unmarshal(buf.Bytes(), &reports); err != nil {
+			t.Fatalf("invalid json : %v : %v", err, buf.String())
+		}
+		if len(reports) != count {
+			t.Errorf("report count mismatch. expected=%v, actual=%v", count, len(reports))
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"github.com/disintegration/gift"
+	"github.com/mitchellh/mapstructure"
+	"image"
+	"math"
+	"strings"
+)
+
+// resize modes
+const (
+	ResizeFit     = "fit"     // scale to fit in size keeping aspect ratio
+	ResizeFill    = "fill"    // scale to fill size keeping aspect ratio, and crop overflow at center
+	ResizeStretch = "stretch" // scale to size ignoring aspect ratio
+)
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+type ResizeOption struct {
+	Width      int    // 0 is not limited in fit mode
+	Height     int    // 0 is not limited in fit mode
+	Mode       string // fit, fill, stretch. default: fit
+	Resampling string // nearest, box, linear, cubic, lanczos. default: lanczos
+	Upscale    bool   // enlarge image smaller than size
+}
+
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "resize",
+		Option: ResizeOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewResizeOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewResizeFilter(*option.(*ResizeOption))
+		},
+	})
+}
+
+func NewResizeOption(m map[string]interface{}) (*ResizeOption, error) {
+	option := ResizeOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := option.validate(); err != nil {
+		return nil, err
+	}
+	return &option, nil
+}
+
+func (o ResizeOption) validate() error {
+	if _, err := parseResampling(o.Resampling); err != nil {
+		return err
+	}
+	if o.Width < 0 || o.Height < 0 {
+		return errors.New("Resize width and height should not be negative")
+	}
+
+	switch o.Mode {
+	case "", ResizeFit:
+		if o.Width == 0 && o.Height == 0 {
+			return errors.New("Resize width or height should be set")
+		}
+	case ResizeFill, ResizeStretch:
+		if o.Width == 0 || o.Height == 0 {
+			return errors.New("Resize width and height should be set : " + o.Mode)
+		}
+	default:
+		return errors.New("Unknown resize mode : " + o.Mode)
+	}
+	return nil
+}
+
+func parseResampling(s string) (gift.Resampling, error) {
+	switch strings.ToLower(s) {
+	case "", "lanczos":
+		return gift.LanczosResampling, nil
+	case "cubic":
+		return gift.CubicResampling, nil
+	case "linear":
+		return gift.LinearResampling, nil
+	case "box":
+		return gift.BoxResampling, nil
+	case "nearest":
+		return gift.NearestNeighborResampling, nil
+	}
+	return nil, errors.New("Unknown resampling : " + s)
+}
+
+type ResizeResult struct {
+	image image.Image
+	scale float64
+}
+
+func (r ResizeResult) Image() image.Image {
+	return r.image
+}
+
+// Implements ScaledResult.Scale()
+func (r ResizeResult) Scale() float64 {
+	return r.scale
+}
+
+func (r ResizeResult) Log() {
+}
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// ResizeFilter scales image to size.
+type ResizeFilter struct {
+	option     ResizeOption
+	resampling gift.Resampling
+}
+
+// Create ResizeFilter instance
+func NewResizeFilter(option ResizeOption) *ResizeFilter {
+	resampling, err := parseResampling(option.Resampling)
+	if err != nil {
+		resampling = gift.LanczosResampling
+	}
+	return &ResizeFilter{option, resampling}
+}
+
+// Implements Filter.Run()
+func (f ResizeFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := f.option.validate(); err != nil {
+		return nil, err
+	}
+	dest, scale := f.run(s.Image)
+	return ResizeResult{dest, scale}, nil
+}
+
+// Resized image and its scale. scale of stretch mode is of width
+func (f ResizeFilter) run(src image.Image) (image.Image, float64) {
+	o := f.option
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// empty image can not be scaled
+	if width == 0 || height == 0 {
+		return src, 1
+	}
+
+	// image smaller than size is kept
+	if !o.Upscale && (o.Width == 0 || width <= o.Width) && (o.Height == 0 || height <= o.Height) {
+		return src, 1
+	}
+
+	var g *gift.GIFT
+	var scale float64
+	switch o.Mode {
+	case ResizeFill:
+		scale = math.Max(float64(o.Width) / float64(width), float64(o.Height) / float64(height))
+		if !o.Upscale && scale > 1 {
+			// image smaller than size in either side is cropped without scaling
+			scale = 1
+			g = gift.New(gift.CropToSize(Min(width, o.Width), Min(height, o.Height), gift.CenterAnchor))
+		} else {
+			g = gift.New(gift.ResizeToFill(o.Width, o.Height, f.resampling, gift.CenterAnchor))
+		}
+	case ResizeStretch:
+		stretchWidth, stretchHeight := o.Width, o.Height
+		if !o.Upscale {
+			stretchWidth, stretchHeight = Min(width, o.Width), Min(height, o.Height)
+		}
+		scale = float64(stretchWidth) / float64(width)
+		g = gift.New(gift.Resize(stretchWidth, stretchHeight, f.resampling))
+	default:
+		// gift.ResizeToFit does not enlarge image
+		fitWidth, fitHeight := fitSize(width, height, o.Width, o.Height)
+		scale = float64(fitWidth) / float64(width)
+		g = gift.New(gift.Resize(fitWidth, fitHeight, f.resampling))
+	}
+
+	if g.Bounds(bounds).Size() == bounds.Size() {
+		return src, 1
+	}
+	return applyGift(g, src), scale
+}
+
+// Size of width x height scaled to fit in maxWidth x maxHeight keeping aspect ratio. 0 is not limited.
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := float64(0)
+	if maxWidth > 0 {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 {
+		if heightScale := float64(maxHeight) / float64(height); scale == 0 || heightScale < scale {
+			scale = heightScale
+		}
+	}
+	return Max(1, int(float64(width) * scale + 0.5)), Max(1, int(float64(height) * scale + 0.5))
+}
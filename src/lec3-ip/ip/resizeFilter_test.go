@@ -0,0 +1,115 @@
+package ip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testResize(t *testing.T, img image.Image, option ResizeOption, expectedWidth, expectedHeight int) {
+	result, err := NewResizeFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+
+	bounds := result.Image().Bounds()
+	if bounds.Dx() != expectedWidth || bounds.Dy() != expectedHeight {
+		t.Errorf("size mismatch. option=%v, expected=%vx%v, actual=%vx%v", option, expectedWidth, expectedHeight, bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestResizeModes(t *testing.T) {
+	img := CreateImage(400, 600, color.White)
+
+	testResize(t, img, ResizeOption{Width: 300, Height: 300}, 200, 300)
+	testResize(t, img, ResizeOption{Width: 200}, 200, 300)
+	testResize(t, img, ResizeOption{Width: 300, Height: 300, Mode: ResizeFill}, 300, 300)
+	testResize(t, img, ResizeOption{Width: 300, Height: 200, Mode: ResizeStretch, Resampling: "linear"}, 300, 200)
+}
+
+func TestResizeUpscale(t *testing.T) {
+	img := CreateImage(400, 600, color.White)
+
+	// smaller image is kept
+	testResize(t, img, ResizeOption{Width: 800, Height: 800}, 400, 600)
+	testResize(t, img, ResizeOption{Width: 800, Height: 800, Upscale: true}, 533, 800)
+
+	// empty image is kept
+	empty := image.NewRGBA(image.Rect(0, 0, 0, 600))
+	for _, mode := range []string{ResizeFit, ResizeFill, ResizeStretch} {
+		testResize(t, empty, ResizeOption{Width: 800, Height: 800, Mode: mode, Upscale: true}, 0, 600)
+	}
+}
+
+func TestResizeFillNoUpscale(t *testing.T) {
+	img := CreateImage(400, 600, color.White)
+
+	// side smaller than size is cropped without scaling
+	testResize(t, img, ResizeOption{Width: 500, Height: 300, Mode: ResizeFill}, 400, 300)
+	testResize(t, img, ResizeOption{Width: 500, Height: 300, Mode: ResizeFill, Upscale: true}, 500, 300)
+	testResize(t, img, ResizeOption{Width: 500, Height: 300, Mode: ResizeStretch}, 400, 300)
+}
+
+func TestResizeDpi(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, CreateImage(400, 600, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	// insert pHYs chunk of 300 dpi after IHDR
+	phys := []byte{0, 0, 0, 9, 'p', 'H', 'Y', 's', 0, 0, 0x2e, 0x23, 0, 0, 0x2e, 0x23, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(phys[17:], crc32.ChecksumIEEE(phys[4:17]))
+	data := buf.Bytes()
+	data = append(data[:33:33], append(phys, data[33:]...)...)
+	filename := filepath.Join(dir, "page.png")
+	if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := NewPipeline().Add("resize", NewResizeFilter(ResizeOption{Width: 200}))
+	pages, _, err := pipeline.EncodePages(context.Background(), NewImagePage(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dpi := pages[0].Dpi; dpi < 149.9 || dpi > 150.1 {
+		t.Errorf("dpi is not scaled. expected=150, actual=%v", dpi)
+	}
+}
+
+func TestResizeGray(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 400, 600))
+	result, err := NewResizeFilter(ResizeOption{Width: 200}).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.Image().(*image.Gray); !ok {
+		t.Errorf("grayscale image is not kept : %T", result.Image())
+	}
+}
+
+func TestResizeOption(t *testing.T) {
+	for _, m := range []map[string]interface{}{
+		{},
+		{"width": 100, "mode": "fill"},
+		{"width": 100, "mode": "zoom"},
+		{"width": 100, "resampling": "bicubic"},
+		{"width": -1, "height": 100},
+	} {
+		if _, err := NewResizeOption(m); err == nil {
+			t.Errorf("expected option error : %v", m)
+		}
+	}
+}
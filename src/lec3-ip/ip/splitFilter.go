@@ -0,0 +1,195 @@
+package ip
+
+import (
+	"context"
+	"errors"
+	"github.com/disintegration/gift"
+	"github.com/mitchellh/mapstructure"
+	"image"
+	"log"
+)
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+type SplitOption struct {
+	Threshold            uint8   // min brightness of space (0~255)
+	MinRatio             float32 // min ratio of spread (width / height). default: 1.0
+	SearchRate           float32 // gutter search range from center (0 <= rate < 0.5 of width). 0 splits at center
+	EmptyLineMaxDotCount int
+	Direction            string  // output order. ltr (left page first), rtl (right page first). default: ltr
+}
+
+func init() {
+	RegisterFilter(FilterRegistration{
+		Name:   "split",
+		Option: SplitOption{},
+		DecodeOption: func(m map[string]interface{}) (interface{}, error) {
+			return NewSplitOption(m)
+		},
+		NewFilter: func(option interface{}) Filter {
+			return NewSplitFilter(*option.(*SplitOption))
+		},
+	})
+}
+
+func NewSplitOption(m map[string]interface{}) (*SplitOption, error) {
+	option := SplitOption{}
+
+	err := mapstructure.Decode(m, &option)
+	if err != nil {
+		return nil, err
+	}
+
+	switch option.Direction {
+	case "", "ltr", "rtl":
+	default:
+		return nil, errors.New("Unknown split direction : " + option.Direction)
+	}
+	if option.SearchRate < 0 || option.SearchRate >= 0.5 {
+		return nil, errors.New("searchRate should be 0 <= rate < 0.5")
+	}
+
+	return &option, nil
+}
+
+type SplitFilterResult struct {
+	image    image.Image
+	filename string
+	parts    []ImagePart
+	gutter   int // x position of gutter. -1 if image is not split
+}
+
+func (r SplitFilterResult) Image() image.Image {
+	return r.image
+}
+
+// Implements SplitResult.Parts()
+func (r SplitFilterResult) Parts() []ImagePart {
+	return r.parts
+}
+
+func (r SplitFilterResult) Log() {
+	if r.gutter >= 0 {
+		log.Printf("[SPLIT] %v : %v\n", r.filename, r.gutter)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// ----------------------------------------------------------------------------
+
+// SplitFilter splits double-page spread into left and right pages at gutter.
+type SplitFilter struct {
+	option SplitOption
+}
+
+// Create SplitFilter instance
+func NewSplitFilter(option SplitOption) *SplitFilter {
+	return &SplitFilter{option}
+}
+
+// Implements Filter.Run()
+func (f SplitFilter) Run(ctx context.Context, s *FilterSource) (FilterResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	src := s.Image
+	if !f.isSpread(src.Bounds()) {
+		return SplitFilterResult{src, s.Filename, nil, -1}, nil
+	}
+
+	gutter := f.findGutter(src)
+	left := f.crop(src, image.Rect(0, 0, gutter, src.Bounds().Dy()))
+	right := f.crop(src, image.Rect(gutter, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+
+	parts := []ImagePart{{Image: left, Side: "L"}, {Image: right, Side: "R"}}
+	if f.option.Direction == "rtl" {
+		parts[0], parts[1] = parts[1], parts[0]
+	}
+	return SplitFilterResult{src, s.Filename, parts, gutter}, nil
+}
+
+// Check if image is landscape spread
+func (f SplitFilter) isSpread(bounds image.Rectangle) bool {
+	minRatio := f.option.MinRatio
+	if minRatio <= 0 {
+		minRatio = 1.0
+	}
+	width, height := bounds.Dx(), bounds.Dy()
+	return width > 1 && height > 0 && float32(width) / float32(height) >= minRatio
+}
+
+// Find x position of gutter near center by vertical projection of dark dots.
+// Center of the widest empty column range is the gutter. If no column is empty, column with least dots is used.
+func (f SplitFilter) findGutter(img image.Image) int {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	center := width / 2
+
+	searchWidth := int(float32(width) * f.option.SearchRate)
+	xStart := Max(1, center - searchWidth)
+	xEnd := Min(width - 1, center + searchWidth)
+	if xEnd <= xStart {
+		return center
+	}
+
+	dotCounts := f.calcDotCounts(img, xStart, xEnd, height)
+
+	// widest empty column range. closer to center is preferred if widths are same
+	bestStart, bestWidth, bestDistance := -1, 0, width
+	for x := xStart; x < xEnd; {
+		if dotCounts[x - xStart] > f.option.EmptyLineMaxDotCount {
+			x++
+			continue
+		}
+		start := x
+		for x < xEnd && dotCounts[x - xStart] <= f.option.EmptyLineMaxDotCount {
+			x++
+		}
+		distance := abs(start + (x - start) / 2 - center)
+		if x - start > bestWidth || (x - start == bestWidth && distance < bestDistance) {
+			bestStart, bestWidth, bestDistance = start, x - start, distance
+		}
+	}
+	if bestStart >= 0 {
+		return bestStart + bestWidth / 2
+	}
+
+	// column with least dots
+	gutter := center
+	minDotCount := height + 1
+	for x := xStart; x < xEnd; x++ {
+		dotCount := dotCounts[x - xStart]
+		if dotCount < minDotCount || (dotCount == minDotCount && abs(x - center) < abs(gutter - center)) {
+			gutter = x
+			minDotCount = dotCount
+		}
+	}
+	return gutter
+}
+
+// Count dots darker than threshold in each column from xStart to xEnd
+func (f SplitFilter) calcDotCounts(img image.Image, xStart, xEnd, height int) []int {
+	bounds := img.Bounds()
+	thresholdSum := uint32(f.option.Threshold) * 256 * 3
+
+	dotCounts := make([]int, xEnd - xStart)
+	for x := xStart; x < xEnd; x++ {
+		dotCount := 0
+		for y := 0; y < height; y++ {
+			if r, g, b, _ := img.At(bounds.Min.X + x, bounds.Min.Y + y).RGBA(); (r + g + b) < thresholdSum {
+				dotCount++
+			}
+		}
+		dotCounts[x - xStart] = dotCount
+	}
+	return dotCounts
+}
+
+// Crop rect of image. rect is relative to image bounds.
+func (f SplitFilter) crop(img image.Image, rect image.Rectangle) image.Image {
+	rect = rect.Add(img.Bounds().Min)
+	dest := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	gift.New(gift.Crop(rect)).Draw(dest, img)
+	return dest
+}
@@ -0,0 +1,127 @@
+package ip
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// spread of 400x300. left page is black and right page is gray with empty gutter at 220 ~ 240
+func createTestSpread() *image.RGBA {
+	img := CreateImage(400, 300, color.White)
+	FillRect(img, 20, 20, 220, 280, color.Black)
+	FillRect(img, 240, 20, 380, 280, color.Gray{100})
+	return img
+}
+
+func runSplit(t *testing.T, img image.Image, option SplitOption) SplitFilterResult {
+	result, err := NewSplitFilter(option).Run(context.Background(), NewFilterSource(img, "filename"))
+	if err != nil {
+		t.Fatalf("filter failed : %v", err)
+	}
+	return result.(SplitFilterResult)
+}
+
+func TestSplitGutter(t *testing.T) {
+	result := runSplit(t, createTestSpread(), SplitOption{Threshold: 200, SearchRate: 0.2})
+	if result.gutter < 220 || result.gutter >= 240 {
+		t.Errorf("gutter mismatch : %v", result.gutter)
+	}
+
+	parts := result.Parts()
+	if len(parts) != 2 || parts[0].Side != "L" || parts[1].Side != "R" {
+		t.Fatalf("parts mismatch : %v", parts)
+	}
+	if width := parts[0].Image.Bounds().Dx() + parts[1].Image.Bounds().Dx(); width != 400 {
+		t.Errorf("split width mismatch : %v", width)
+	}
+	if r, _, _, _ := parts[0].Image.At(100, 100).RGBA(); r != 0 {
+		t.Errorf("left page is not black : %v", r)
+	}
+}
+
+func TestSplitCenter(t *testing.T) {
+	result := runSplit(t, createTestSpread(), SplitOption{Threshold: 200})
+	if result.gutter != 200 {
+		t.Errorf("gutter is not center : %v", result.gutter)
+	}
+}
+
+func TestSplitRtl(t *testing.T) {
+	parts := runSplit(t, createTestSpread(), SplitOption{Threshold: 200, SearchRate: 0.2, Direction: "rtl"}).Parts()
+	if len(parts) != 2 || parts[0].Side != "R" || parts[1].Side != "L" {
+		t.Fatalf("parts mismatch : %v", parts)
+	}
+	if r, _, _, _ := parts[0].Image.At(50, 100).RGBA(); r == 0 {
+		t.Error("right page is not first")
+	}
+}
+
+func TestSplitPortrait(t *testing.T) {
+	result := runSplit(t, CreateImage(200, 300, color.White), SplitOption{Threshold: 200})
+	if len(result.Parts()) != 0 || result.gutter >= 0 {
+		t.Errorf("portrait page is split : %v", result.gutter)
+	}
+
+	// landscape page below min ratio
+	result = runSplit(t, CreateImage(400, 300, color.White), SplitOption{Threshold: 200, MinRatio: 1.5})
+	if len(result.Parts()) != 0 {
+		t.Error("page below min ratio is split")
+	}
+}
+
+func TestSplitOption(t *testing.T) {
+	if _, err := NewSplitOption(map[string]interface{}{"direction": "up"}); err == nil {
+		t.Error("expected direction error")
+	}
+	if _, err := NewSplitOption(map[string]interface{}{"searchRate": 0.5}); err == nil {
+		t.Error("expected searchRate error")
+	}
+}
+
+func TestPipelineSplit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := SaveJpeg(createTestSpread(), dir, "spread.jpg", 90); err != nil {
+		t.Fatal(err)
+	}
+
+	// split pages are cropped separately
+	pipeline := NewPipeline().Add("split", NewSplitFilter(SplitOption{Threshold: 200, SearchRate: 0.2, Direction: "rtl"}))
+	pipeline.Add("autoCrop", NewAutoCropFilter(AutoCropOption{
+		Threshold: 220,
+		MaxRatio:  10.0,
+		MaxWidthCropRate: 0.5, MaxHeightCropRate: 0.5,
+	}))
+
+	destDir := filepath.Join(dir, "output")
+	report, err := pipeline.ProcessFile(context.Background(), filepath.Join(dir, "spread.jpg"), destDir)
+	if err != nil {
+		t.Fatalf("ProcessFile failed : %v", err)
+	}
+
+	if len(report.Parts) != 2 || report.Parts[0].Side != "R" || report.Dest != report.Parts[0].Dest {
+		t.Fatalf("parts report mismatch : %v", report.Parts)
+	}
+	if len(report.Filters) != 3 || report.Filters[0].Split != 2 || report.Filters[1].Side != "R" || report.Filters[2].Side != "L" {
+		t.Errorf("filter report mismatch : %v", report.Filters)
+	}
+
+	for _, filename := range []string{"spread_L.jpg", "spread_R.jpg"} {
+		img, err := LoadImage(filepath.Join(destDir, filename))
+		if err != nil {
+			t.Fatalf("failed to load result : %v", err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() > 200 || bounds.Dy() >= 300 {
+			t.Errorf("%v not cropped : %v", filename, bounds)
+		}
+	}
+}
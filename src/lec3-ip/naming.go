@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"lec3-ip/ip"
+)
+
+//-----------------------------------------------------------------------------
+// Output name
+//-----------------------------------------------------------------------------
+
+// Numbering group of {index} and {seq} of page. Pages are numbered in each output folder if name template has {folder},
+// otherwise in dest directory.
+func numberingGroupOf(config *Config, filename string, page ip.ImagePage) string {
+	if config.dest.name == nil || !config.dest.name.Uses("folder") {
+		return config.dest.dir
+	}
+	folder := path.Join(path.Dir(filename), page.Dir())
+	return filepath.Join(config.dest.dir, filepath.FromSlash(folder))
+}
+
+// Get function returning numbering group of pages of filename, and true if the group is written by sink.
+// Pages are grouped by book in package mode. Pages of sequence numbered names are written by sink in order.
+func pageGroupOf(config *Config, sink *ip.OrderedSink, filename string) func(page ip.ImagePage) (string, bool) {
+	return func(page ip.ImagePage) (string, bool) {
+		if config.dest.book != bookNone {
+			if book := bookOf(config, filename); book != "" {
+				return book, sink != nil
+			}
+			// folder is not packaged in watch mode
+			return numberingGroupOf(config, filename, page), false
+		}
+		return numberingGroupOf(config, filename, page), sink != nil
+	}
+}
+
+// Create sink writing images of output named by config.dest.name with gap-free sequence numbers.
+// Numbering continues from previous run if state is not nil.
+func newSequenceSink(o *output, state *processState) *ip.OrderedSink {
+	config := o.config
+	return ip.NewOrderedSink(func(group string) (ip.BookWriter, error) {
+		writer := ip.NewSequenceWriter(config.dest.dir, config.dest.name, config.dest.overwrite)
+		if state == nil {
+			return writer, nil
+		}
+
+		key := group
+		if rel, err := filepath.Rel(config.dest.dir, group); err == nil {
+			key = filepath.ToSlash(rel)
+		}
+		key = o.stateKey(key)
+		return &sequenceStateWriter{writer.SetSeq(state.Sequence(key)), state, key}, nil
+	})
+}
+
+// SequenceWriter recording number of written images in state
+type sequenceStateWriter struct {
+	*ip.SequenceWriter
+	state *processState
+	key   string
+}
+
+func (w *sequenceStateWriter) WritePage(page *ip.BookPage) error {
+	err := w.SequenceWriter.WritePage(page)
+	if stateErr := w.state.SetSequence(w.key, w.Seq()); stateErr != nil && err == nil {
+		err = stateErr
+	}
+	return err
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"lec3-ip/ip"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// Process state
+//-----------------------------------------------------------------------------
+
+const stateFilename = ".lec3-ip-state.json"
+
+// state is saved at most once in stateSaveInterval while processing
+const stateSaveInterval = 5 * time.Second
+
+// Processed source file
+type fileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"`   // sha1 of file content
+	Config  string    `json:"config"` // Config.Hash()
+	Dest    string    `json:"dest,omitempty"`
+}
+
+// Number of images written to a numbering group of {seq}
+type sequenceState struct {
+	Seq    int    `json:"seq"`
+	Config string `json:"config"` // Config.Hash()
+}
+
+// Content of state file
+type stateFile struct {
+	Files     map[string]fileState     `json:"files"`
+	Sequences map[string]sequenceState `json:"sequences,omitempty"`
+}
+
+// processState keeps source files processed in previous runs. Safe for concurrent use.
+type processState struct {
+	filename   string
+	configHash string
+	files      map[string]fileState     // key : path relative to src.dir
+	sequences  map[string]sequenceState // key : numbering group relative to dest.dir
+	dirty      bool
+	savedAt    time.Time
+	lock       sync.Mutex
+}
+
+// Load state file. Empty state is returned if state file does not exist.
+func loadProcessState(filename string, configHash string) (*processState, error) {
+	s := &processState{
+		filename:   filename,
+		configHash: configHash,
+		files:      make(map[string]fileState),
+		sequences:  make(map[string]sequenceState),
+		savedAt:    time.Now(),
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content stateFile
+	if err := json.Unmarshal(data, &content); err == nil && content.Files != nil {
+		s.files = content.Files
+		if content.Sequences != nil {
+			s.sequences = content.Sequences
+		}
+		return s, nil
+	}
+
+	// state file of previous version has files only
+	if err := json.Unmarshal(data, &s.files); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func hashFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Source file of works. Size and modification time are read when the file is collected,
+// and content is hashed at most once for all pages of the file.
+type srcFile struct {
+	filename string
+	size     int64
+	modTime  time.Time
+	statErr  error
+	hashOnce sync.Once
+	hash     string
+	hashErr  error
+}
+
+func newSrcFile(filename string) *srcFile {
+	f := &srcFile{filename: filename}
+	if file, err := os.Stat(filename); err != nil {
+		f.statErr = err
+	} else {
+		f.size, f.modTime = file.Size(), file.ModTime()
+	}
+	return f
+}
+
+// sha1 of content. Returns error if file is changed since it is collected.
+func (f *srcFile) Hash() (string, error) {
+	f.hashOnce.Do(func() {
+		if f.statErr != nil {
+			f.hashErr = f.statErr
+			return
+		}
+		if f.hash, f.hashErr = hashFile(f.filename); f.hashErr != nil {
+			return
+		}
+		if file, err := os.Stat(f.filename); err != nil || file.Size() != f.size || !file.ModTime().Equal(f.modTime) {
+			f.hashErr = errors.New("Source file is changed : " + f.filename)
+		}
+	})
+	return f.hash, f.hashErr
+}
+
+// Check if src is processed with current config and not changed since then
+func (s *processState) IsProcessed(key string, src *srcFile) bool {
+	s.lock.Lock()
+	prev, ok := s.files[key]
+	s.lock.Unlock()
+
+	if !ok || prev.Config != s.configHash {
+		return false
+	}
+
+	// output is removed
+	if prev.Dest != "" {
+		if _, err := os.Stat(prev.Dest); err != nil {
+			return false
+		}
+	}
+
+	if src.statErr != nil {
+		return false
+	}
+	if src.size == prev.Size && src.modTime.Equal(prev.ModTime) {
+		return true
+	}
+
+	// modification time can be changed without content change
+	if src.size != prev.Size {
+		return false
+	}
+	hash, err := src.Hash()
+	if err != nil || hash != prev.Hash {
+		return false
+	}
+
+	prev.ModTime = src.modTime
+	s.set(key, prev)
+	return true
+}
+
+// Record src as processed. Content hashed when src is collected is recorded, and src changed since then is not recorded.
+func (s *processState) Set(key string, src *srcFile, dest string) error {
+	hash, err := src.Hash()
+	if err != nil {
+		return err
+	}
+
+	return s.set(key, fileState{
+		Size:    src.size,
+		ModTime: src.modTime,
+		Hash:    hash,
+		Config:  s.configHash,
+		Dest:    dest,
+	})
+}
+
+func (s *processState) set(key string, state fileState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.files[key] = state
+	s.dirty = true
+
+	if time.Since(s.savedAt) < stateSaveInterval {
+		return nil
+	}
+	return s.save()
+}
+
+// Number of images written to numbering group with current config. 0 if config is changed.
+func (s *processState) Sequence(key string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if seq, ok := s.sequences[key]; ok && seq.Config == s.configHash {
+		return seq.Seq
+	}
+	return 0
+}
+
+// Record number of images written to numbering group
+func (s *processState) SetSequence(key string, seq int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sequences[key] = sequenceState{seq, s.configHash}
+	s.dirty = true
+
+	if time.Since(s.savedAt) < stateSaveInterval {
+		return nil
+	}
+	return s.save()
+}
+
+// Save state file if changed
+func (s *processState) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.save()
+}
+
+func (s *processState) save() error {
+	if !s.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(stateFile{s.files, s.sequences}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0777); err != nil {
+		return err
+	}
+
+	err = ip.WriteFileAtomic(s.filename, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.dirty = false
+	s.savedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcFilename := filepath.Join(dir, "page1.jpg")
+	destFilename := filepath.Join(dir, "output", "page1.jpg")
+	statePath := filepath.Join(dir, "output", stateFilename)
+	ioutil.WriteFile(srcFilename, []byte("page1"), 0666)
+	os.MkdirAll(filepath.Dir(destFilename), 0777)
+	ioutil.WriteFile(destFilename, []byte("page1"), 0666)
+
+	state, err := loadProcessState(statePath, "config1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.IsProcessed("page1.jpg", newSrcFile(srcFilename)) {
+		t.Errorf("unprocessed file is skipped")
+	}
+	if err := state.Set("page1.jpg", newSrcFile(srcFilename), destFilename); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	state, err = loadProcessState(statePath, "config1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsProcessed("page1.jpg", newSrcFile(srcFilename)) {
+		t.Errorf("processed file is not skipped")
+	}
+
+	// modification time changed without content change
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(srcFilename, modTime, modTime)
+	if !state.IsProcessed("page1.jpg", newSrcFile(srcFilename)) {
+		t.Errorf("touched file is not skipped")
+	}
+
+	// content changed
+	ioutil.WriteFile(srcFilename, []byte("PAGE1"), 0666)
+	if state.IsProcessed("page1.jpg", newSrcFile(srcFilename)) {
+		t.Errorf("modified file is skipped")
+	}
+	state.Set("page1.jpg", newSrcFile(srcFilename), destFilename)
+
+	// config changed
+	state.configHash = "config2"
+	if state.IsProcessed("page1.jpg", newSrcFile(srcFilename)) {
+		t.Errorf("file is skipped after config change")
+	}
+	state.configHash = "config1"
+
+	// output removed
+	os.Remove(destFilename)
+	if state.IsProcessed("page1.jpg", newSrcFile(srcFilename)) {
+		t.Errorf("file is skipped after output is removed")
+	}
+
+	// file changed after it is collected is not recorded
+	src := newSrcFile(srcFilename)
+	modTime = time.Now().Add(2 * time.Minute)
+	os.Chtimes(srcFilename, modTime, modTime)
+	if err := state.Set("page1.jpg", src, destFilename); err == nil {
+		t.Errorf("file changed while processing is recorded")
+	}
+}
+
+func TestSrcFileHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcFilename := filepath.Join(dir, "book.cbz")
+	ioutil.WriteFile(srcFilename, []byte("book"), 0666)
+
+	// content is hashed once for all pages
+	src := newSrcFile(srcFilename)
+	hash, err := src.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(srcFilename, []byte("BOOK"), 0666)
+	if hash2, _ := src.Hash(); hash2 != hash {
+		t.Errorf("file is hashed again")
+	}
+}
+
+func TestProcessStateSequence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	statePath := filepath.Join(dir, stateFilename)
+	state, err := loadProcessState(statePath, "config1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := state.Sequence("vol1"); seq != 0 {
+		t.Errorf("sequence of new group : %v", seq)
+	}
+	state.SetSequence("vol1", 3)
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	state, err = loadProcessState(statePath, "config1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := state.Sequence("vol1"); seq != 3 {
+		t.Errorf("sequence is not restored : %v", seq)
+	}
+
+	// config changed
+	state.configHash = "config2"
+	if seq := state.Sequence("vol1"); seq != 0 {
+		t.Errorf("sequence is kept after config change : %v", seq)
+	}
+
+	// state file of previous version
+	ioutil.WriteFile(statePath, []byte(`{"page1.jpg": {"hash": "abc", "config": "config1"}}`), 0666)
+	state, err = loadProcessState(statePath, "config1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.files["page1.jpg"]; !ok {
+		t.Errorf("files of previous version are not loaded")
+	}
+	if seq := state.Sequence("vol1"); seq != 0 {
+		t.Errorf("sequence of previous version : %v", seq)
+	}
+}
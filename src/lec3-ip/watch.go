@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	"lec3-ip/ip"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+//-----------------------------------------------------------------------------
+// Change notifier
+//-----------------------------------------------------------------------------
+
+// Notifies paths of created or modified files and directories in source directory
+type changeNotifier interface {
+	Changes() <-chan string
+	Close() error
+}
+
+// create changeNotifier. mode : "notify", "poll", or "auto" to fall back to polling if notification is not available
+func newChangeNotifier(mode string, dir string, recursive bool, pollInterval time.Duration) (changeNotifier, error) {
+	switch mode {
+	case "poll":
+		return newPollNotifier(dir, recursive, pollInterval)
+	case "notify":
+		return newFsNotifier(dir, recursive)
+	case "auto", "":
+		notifier, err := newFsNotifier(dir, recursive)
+		if err == nil {
+			return notifier, nil
+		}
+		log.Printf("Filesystem notification is not available. fall back to polling : %v\n", err)
+		return newPollNotifier(dir, recursive, pollInterval)
+	}
+	return nil, errors.New("Unknown watchMode : " + mode)
+}
+
+// fsNotifier uses filesystem notification (inotify on Linux)
+type fsNotifier struct {
+	watcher   *fsnotify.Watcher
+	recursive bool
+	changes   chan string
+	done      chan struct{}
+}
+
+func newFsNotifier(dir string, recursive bool) (*fsNotifier, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &fsNotifier{
+		watcher:   watcher,
+		recursive: recursive,
+		changes:   make(chan string, 100),
+		done:      make(chan struct{}),
+	}
+	if err := n.addDir(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go n.run()
+	return n, nil
+}
+
+// watch dir. subdirectories are also watched if recursive is true.
+func (n *fsNotifier) addDir(dir string) error {
+	if !n.recursive {
+		return n.watcher.Add(dir)
+	}
+	return filepath.Walk(dir, func(filename string, file os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.IsDir() {
+			return n.watcher.Add(filename)
+		}
+		return nil
+	})
+}
+
+func (n *fsNotifier) run() {
+	defer close(n.changes)
+
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return
+			}
+			// files moved into watched directory are notified as Create
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 && n.recursive {
+				if file, err := os.Stat(event.Name); err == nil && file.IsDir() {
+					if err := n.addDir(event.Name); err != nil {
+						log.Printf("Failed to watch directory : %v : %v\n", event.Name, err)
+					}
+				}
+			}
+
+			select {
+			case n.changes <- event.Name:
+			case <-n.done:
+				return
+			}
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watch error : %v\n", err)
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *fsNotifier) Changes() <-chan string {
+	return n.changes
+}
+
+func (n *fsNotifier) Close() error {
+	close(n.done)
+	return n.watcher.Close()
+}
+
+// pollNotifier compares directory listing periodically
+type pollNotifier struct {
+	dir       string
+	recursive bool
+	snapshot  map[string]fileStat
+	changes   chan string
+	done      chan struct{}
+}
+
+func newPollNotifier(dir string, recursive bool, interval time.Duration) (*pollNotifier, error) {
+	n := &pollNotifier{
+		dir:       dir,
+		recursive: recursive,
+		changes:   make(chan string, 100),
+		done:      make(chan struct{}),
+	}
+
+	var err error
+	if n.snapshot, err = n.list(); err != nil {
+		return nil, err
+	}
+
+	go n.run(interval)
+	return n, nil
+}
+
+func (n *pollNotifier) list() (map[string]fileStat, error) {
+	files, err := ip.ReadImages(n.dir, n.recursive, "")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]fileStat)
+	for _, file := range files {
+		snapshot[file.Path] = newFileStat(file)
+	}
+	return snapshot, nil
+}
+
+func (n *pollNotifier) run(interval time.Duration) {
+	defer close(n.changes)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			snapshot, err := n.list()
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			for path, stat := range snapshot {
+				if prevStat, ok := n.snapshot[path]; ok && prevStat == stat {
+					continue
+				}
+				select {
+				case n.changes <- filepath.Join(n.dir, filepath.FromSlash(path)):
+				case <-n.done:
+					return
+				}
+			}
+			n.snapshot = snapshot
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *pollNotifier) Changes() <-chan string {
+	return n.changes
+}
+
+func (n *pollNotifier) Close() error {
+	close(n.done)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Image watcher
+//-----------------------------------------------------------------------------
+
+type fileStat struct {
+	size    int64
+	modTime time.Time
+}
+
+func newFileStat(file os.FileInfo) fileStat {
+	return fileStat{file.Size(), file.ModTime()}
+}
+
+// file waiting for its size to stop changing
+type pendingFile struct {
+	stat  fileStat
+	since time.Time // last time stat is changed
+	order int       // order in initial scan starting from 1. 0 if not scanned
+}
+
+// files ready to dispatch. files of initial scan keep order of scan, and the others follow in natural order
+type readyFiles struct {
+	paths  []string
+	orders map[string]int
+}
+
+func (r readyFiles) Len() int {
+	return len(r.paths)
+}
+
+func (r readyFiles) Swap(i, j int) {
+	r.paths[i], r.paths[j] = r.paths[j], r.paths[i]
+}
+
+func (r readyFiles) Less(i, j int) bool {
+	oi, oj := r.orders[r.paths[i]], r.orders[r.paths[j]]
+	if oi == 0 || oj == 0 {
+		return oi != 0 && oj == 0
+	}
+	return oi < oj
+}
+
+// imageWatcher dispatches works of changed images after their size stops changing
+type imageWatcher struct {
+	srcDir         string
+	destDirs       []string // absolute dest directories to exclude
+	recursive      bool
+	manifest       string // manifest filename to sort images of initial scan
+	stableDuration time.Duration
+	pending        map[string]*pendingFile // key : path relative to srcDir
+	dispatched     map[string]fileStat
+}
+
+func newImageWatcher(srcDir string, destDirs []string, recursive bool, stableDuration time.Duration) *imageWatcher {
+	return &imageWatcher{
+		srcDir:         srcDir,
+		destDirs:       destDirs,
+		recursive:      recursive,
+		stableDuration: stableDuration,
+		pending:        make(map[string]*pendingFile),
+		dispatched:     make(map[string]fileStat),
+	}
+}
+
+// path relative to srcDir. returns false if filename is excluded.
+func (w *imageWatcher) relPath(filename string) (string, bool) {
+	if absFilename, err := filepath.Abs(filename); err == nil && isInDirs(absFilename, w.destDirs) {
+		return "", false
+	}
+	rel, err := filepath.Rel(w.srcDir, filename)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Add all images in srcDir as pending. They are dispatched in order of scan after their size stops changing.
+func (w *imageWatcher) scan() error {
+	files, err := ip.ReadImages(w.srcDir, w.recursive, w.manifest)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, file := range files {
+		rel, ok := w.relPath(filepath.Join(w.srcDir, filepath.FromSlash(file.Path)))
+		if !ok {
+			continue
+		}
+		w.pending[rel] = &pendingFile{newFileStat(file), now, i + 1}
+	}
+	return nil
+}
+
+// Add changed file or directory
+func (w *imageWatcher) add(filename string) {
+	file, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+
+	if file.IsDir() {
+		// files in a directory moved into srcDir are not notified
+		if !w.recursive {
+			return
+		}
+		files, err := ip.ReadImages(filename, true, "")
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		for _, f := range files {
+			w.add(filepath.Join(filename, filepath.FromSlash(f.Path)))
+		}
+		return
+	}
+
+	if !ip.IsImageFile(filename) {
+		return
+	}
+	rel, ok := w.relPath(filename)
+	if !ok {
+		return
+	}
+
+	stat := newFileStat(file)
+	order := 0
+	if p, ok := w.pending[rel]; ok {
+		if p.stat == stat {
+			return
+		}
+		order = p.order
+	}
+	w.pending[rel] = &pendingFile{stat, time.Now(), order}
+}
+
+// Dispatch file again on next check. ex) book of previous version is still being written
+func (w *imageWatcher) retry(rel string) {
+	delete(w.dispatched, rel)
+	file, err := os.Stat(filepath.Join(w.srcDir, filepath.FromSlash(rel)))
+	if err != nil {
+		return
+	}
+	// stable since long ago
+	w.pending[rel] = &pendingFile{newFileStat(file), time.Time{}, 0}
+}
+
+// Check size of pending files. Returns files of which size stopped changing.
+func (w *imageWatcher) checkPending() []string {
+	var ready []string
+	orders := make(map[string]int)
+	now := time.Now()
+
+	for rel, p := range w.pending {
+		file, err := os.Stat(filepath.Join(w.srcDir, filepath.FromSlash(rel)))
+		if err != nil {
+			delete(w.pending, rel)
+			continue
+		}
+
+		stat := newFileStat(file)
+		if stat != p.stat {
+			p.stat = stat
+			p.since = now
+			continue
+		}
+		if now.Sub(p.since) < w.stableDuration {
+			continue
+		}
+
+		delete(w.pending, rel)
+		if prevStat, ok := w.dispatched[rel]; ok && prevStat == stat {
+			continue
+		}
+		w.dispatched[rel] = stat
+		ready = append(ready, rel)
+		orders[rel] = p.order
+	}
+
+	ip.SortNatural(ready)
+	sort.Stable(readyFiles{ready, orders})
+	return ready
+}
+
+// Watch source directory and add works of new/modified images. Returns when ctx is done.
+// Archives are packaged into books if sink of output is not nil.
+func watchImages(ctx context.Context, workChan chan <- Work, config *Config, outputs []*output) {
+	w := newImageWatcher(config.src.dir, outputDirs(outputs), config.src.recursive, time.Duration(config.watchDelay) * time.Second)
+	w.manifest = config.src.manifest
+
+	// start watching before initial scan not to miss files
+	notifier, err := newChangeNotifier(config.watchMode, config.src.dir, config.src.recursive, time.Duration(config.pollInterval) * time.Second)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer notifier.Close()
+
+	// page numbers continue in each numbering group
+	counters := newPageCounters(outputs)
+	dispatch := func(files []string) bool {
+		if len(files) > 0 {
+			log.Printf("[+] %v\n", len(files))
+		}
+		for _, rel := range files {
+			books := make([]string, len(outputs))
+			writing := false
+			for i, o := range outputs {
+				if o.sink != nil && o.config.dest.book != bookNone {
+					books[i] = bookOf(o.config, rel)
+					writing = writing || (books[i] != "" && o.sink.IsWriting(books[i]))
+				}
+			}
+			// modified archive waits until book of previous version is finished
+			if writing {
+				w.retry(rel)
+				continue
+			}
+
+			// modified archive is written to a new book
+			for i, book := range books {
+				if book != "" {
+					delete(counters[i].counts, book)
+				}
+			}
+			if !addWorks(ctx, workChan, config.src.dir, rel, outputs, counters) {
+				return false
+			}
+			for i, book := range books {
+				if book != "" {
+					setBookCount(outputs[i].sink, book, counters[i].counts[book])
+				}
+			}
+		}
+		return true
+	}
+
+	if err := w.scan(); err != nil {
+		log.Println(err)
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case filename, ok := <-notifier.Changes():
+			if !ok {
+				return
+			}
+			w.add(filename)
+		case <-ticker.C:
+			if !dispatch(w.checkPending()) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
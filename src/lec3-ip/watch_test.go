@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImageWatcherStableSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "page1.jpg")
+	ioutil.WriteFile(filename, []byte("1"), 0666)
+
+	w := newImageWatcher(dir, []string{filepath.Join(dir, "output")}, false, time.Hour)
+
+	// scanned file is pending
+	if err := w.scan(); err != nil {
+		t.Fatal(err)
+	}
+	if ready := w.checkPending(); len(ready) != 0 {
+		t.Errorf("scanned file dispatched before stable duration : %v", ready)
+	}
+
+	// size is changing
+	ioutil.WriteFile(filename, []byte("12"), 0666)
+	w.add(filename)
+	if ready := w.checkPending(); len(ready) != 0 {
+		t.Errorf("file dispatched while size is changing : %v", ready)
+	}
+
+	// size stopped changing
+	w.stableDuration = 0
+	if ready := w.checkPending(); len(ready) != 1 || ready[0] != "page1.jpg" {
+		t.Errorf("stable file not dispatched : %v", ready)
+	}
+
+	// notified again without modification
+	w.add(filename)
+	if ready := w.checkPending(); len(ready) != 0 {
+		t.Errorf("unmodified file dispatched : %v", ready)
+	}
+}
+
+func TestImageWatcherScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modTime := time.Now().Add(-time.Hour)
+	for _, name := range []string{"page10.jpg", "page2.jpg", "page1.jpg"} {
+		filename := filepath.Join(dir, name)
+		ioutil.WriteFile(filename, []byte("1"), 0666)
+		os.Chtimes(filename, modTime, modTime)
+	}
+
+	w := newImageWatcher(dir, nil, false, time.Hour)
+	if err := w.scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	// old file may still be growing. ex) copied with its modification time
+	ioutil.WriteFile(filepath.Join(dir, "page2.jpg"), []byte("12"), 0666)
+	os.Chtimes(filepath.Join(dir, "page2.jpg"), modTime, modTime)
+	if ready := w.checkPending(); len(ready) != 0 {
+		t.Errorf("old file dispatched without stable duration : %v", ready)
+	}
+
+	// scanned files keep order of scan, and notified file follows
+	ioutil.WriteFile(filepath.Join(dir, "page0.jpg"), []byte("1"), 0666)
+	w.add(filepath.Join(dir, "page0.jpg"))
+	w.stableDuration = 0
+	ready := w.checkPending()
+	if strings.Join(ready, ",") != "page1.jpg,page2.jpg,page10.jpg,page0.jpg" {
+		t.Errorf("unexpected dispatch order : %v", ready)
+	}
+}
+
+func TestImageWatcherExcludeDest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	destDir := filepath.Join(dir, "output")
+	os.MkdirAll(destDir, 0777)
+	ioutil.WriteFile(filepath.Join(dir, "page1.jpg"), []byte("1"), 0666)
+	ioutil.WriteFile(filepath.Join(destDir, "page1.jpg"), []byte("1"), 0666)
+
+	w := newImageWatcher(dir, []string{destDir}, true, 0)
+	w.add(dir)
+	if ready := w.checkPending(); len(ready) != 1 || ready[0] != "page1.jpg" {
+		t.Errorf("unexpected dispatch : %v", ready)
+	}
+}
+
+func TestImageWatcherRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lec3-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "book.cbz"), []byte("1"), 0666)
+
+	w := newImageWatcher(dir, nil, false, time.Hour)
+	w.add(filepath.Join(dir, "book.cbz"))
+	w.stableDuration = 0
+	if ready := w.checkPending(); len(ready) != 1 {
+		t.Fatalf("file not dispatched : %v", ready)
+	}
+
+	// file is dispatched again without modification
+	w.stableDuration = time.Hour
+	w.retry("book.cbz")
+	if ready := w.checkPending(); len(ready) != 1 || ready[0] != "book.cbz" {
+		t.Errorf("retried file not dispatched : %v", ready)
+	}
+}